@@ -0,0 +1,186 @@
+package gosrv
+
+import (
+  "bufio"
+  "io"
+  "os"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+
+// Overflow policies for AsyncWriter.
+const (
+  BlockOnOverflow = "block"
+  DropOnOverflow  = "drop"
+)
+
+// Default queue size and flush interval of an AsyncWriter.
+var DefaultLogBufferSize    = 1024
+var DefaultLogFlushInterval = time.Second
+
+
+// A writer queueing writes to be written to another writer in the
+// background, so slow disks or pipes don't delay responses. Lines are
+// buffered and flushed every flush interval, on Flush and on Close. When
+// the queue is full, Write blocks or drops the line depending on the
+// overflow policy. Lines that fail to be written are dropped too, and later
+// lines are written again. Safe for concurrent use.
+type AsyncWriter struct {
+  writer    io.Writer
+  buffer    *bufio.Writer
+  queue     chan *[]byte
+  flushes   chan chan error
+  done      chan bool
+  interval  time.Duration
+  drop      bool
+  dropped   int64
+  pending   int64
+  closed    bool
+  mutex     sync.RWMutex
+}
+
+var asyncBufferPool = sync.Pool{New: func() interface{} {
+  b := make([]byte, 0, 512)
+  return &b
+}}
+
+
+// Creates an AsyncWriter queueing up to size writes, flushed every
+// interval, with the given overflow policy: "block" or "drop".
+func NewAsyncWriter(wr io.Writer, size int, interval time.Duration, overflow string) *AsyncWriter {
+  if size <= 0 { size = DefaultLogBufferSize }
+  if interval <= 0 { interval = DefaultLogFlushInterval }
+
+  w := &AsyncWriter{writer: wr, buffer: bufio.NewWriterSize(wr, 32 << 10),
+    queue: make(chan *[]byte, size), flushes: make(chan chan error),
+    done: make(chan bool), interval: interval, drop: overflow == DropOnOverflow}
+
+  go w.run()
+  return w
+}
+
+
+// Queues a copy of the given bytes.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+  b := asyncBufferPool.Get().(*[]byte)
+  *b = append((*b)[:0], p...)
+
+  w.mutex.RLock()
+  defer w.mutex.RUnlock()
+  if w.closed { return 0, os.ErrClosed }
+
+  if !w.drop {
+    w.queue <- b
+    return len(p), nil
+  }
+
+  select {
+  case w.queue <- b:
+  default:
+    atomic.AddInt64(&w.dropped, 1)
+    asyncBufferPool.Put(b)
+  }
+  return len(p), nil
+}
+
+
+// Returns the number of writes dropped because the queue was full or the
+// underlying writer failed.
+func (w *AsyncWriter) Dropped() int64 {
+  return atomic.LoadInt64(&w.dropped)
+}
+
+
+// Writes all queued bytes to the underlying writer.
+func (w *AsyncWriter) Flush() error {
+  w.mutex.RLock()
+  defer w.mutex.RUnlock()
+  if w.closed { return nil }
+
+  errchan := make(chan error)
+  w.flushes <- errchan
+  return <- errchan
+}
+
+
+// Flushes queued bytes and stops the writer. The underlying writer isn't
+// closed.
+func (w *AsyncWriter) Close() error {
+  w.mutex.Lock()
+  if w.closed {
+    w.mutex.Unlock()
+    return nil
+  }
+  w.closed = true
+  close(w.queue)
+  w.mutex.Unlock()
+
+  <- w.done
+  return w.flush()
+}
+
+
+func (w *AsyncWriter) run() {
+  ticker := time.NewTicker(w.interval)
+  defer ticker.Stop()
+  defer close(w.done)
+
+  for {
+    select {
+    case b, ok := <- w.queue:
+      if !ok { return }
+      w.write(b)
+
+    case errchan := <- w.flushes:
+      w.drain()
+      errchan <- w.flush()
+
+    case <- ticker.C:
+      w.flush()
+    }
+  }
+}
+
+
+// Writes the bytes queued so far, without waiting for more.
+func (w *AsyncWriter) drain() {
+  for {
+    select {
+    case b, ok := <- w.queue:
+      if !ok { return }
+      w.write(b)
+    default:
+      return
+    }
+  }
+}
+
+
+func (w *AsyncWriter) write(b *[]byte) {
+  w.pending++
+  _, err := w.buffer.Write(*b)
+  if err != nil { w.reset() }
+  if cap(*b) <= maxPooledLogBuffer { asyncBufferPool.Put(b) }
+}
+
+
+func (w *AsyncWriter) flush() error {
+  err := w.buffer.Flush()
+  if err != nil {
+    w.reset()
+    return err
+  }
+  w.pending = 0
+  return nil
+}
+
+
+// Counts the buffered lines as dropped and clears the buffer error, which
+// bufio.Writer otherwise returns for every later write.
+func (w *AsyncWriter) reset() {
+  atomic.AddInt64(&w.dropped, w.pending)
+  w.pending = 0
+  w.buffer.Reset(w.writer)
+}
@@ -0,0 +1,141 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "fmt"
+  "os"
+  "sync"
+  "time"
+)
+
+
+// A writer blocking until released, standing in for a slow disk.
+type testSlowWriter struct {
+  bytes.Buffer
+  release chan bool
+  mutex   sync.Mutex
+}
+
+
+func (w *testSlowWriter) Write(p []byte) (int, error) {
+  <- w.release
+  w.mutex.Lock()
+  defer w.mutex.Unlock()
+  return w.Buffer.Write(p)
+}
+
+
+func (w *testSlowWriter) String() string {
+  w.mutex.Lock()
+  defer w.mutex.Unlock()
+  return w.Buffer.String()
+}
+
+
+func TestAsyncWriterFlush(t *testing.T) {
+  buf := &testSlowWriter{release: make(chan bool)}
+  close(buf.release)
+
+  w := NewAsyncWriter(buf, 10, time.Hour, BlockOnOverflow)
+  defer w.Close()
+
+  for i := 0; i < 3; i++ { fmt.Fprintf(w, "line %d\n", i) }
+  testAssertEqual(t, "", buf.String())
+
+  err := w.Flush()
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "line 0\nline 1\nline 2\n", buf.String())
+}
+
+
+func TestAsyncWriterInterval(t *testing.T) {
+  buf := &testSlowWriter{release: make(chan bool)}
+  close(buf.release)
+
+  w := NewAsyncWriter(buf, 10, 10 * time.Millisecond, BlockOnOverflow)
+  defer w.Close()
+
+  w.Write([]byte("line\n"))
+  time.Sleep(100 * time.Millisecond)
+  testAssertEqual(t, "line\n", buf.String())
+}
+
+
+func TestAsyncWriterDrop(t *testing.T) {
+  buf := &testSlowWriter{release: make(chan bool)}
+  w := NewAsyncWriter(buf, 2, time.Hour, DropOnOverflow)
+
+  done := make(chan bool)
+  go func() {
+    // Writes return right away even though the writer is stalled.
+    for i := 0; i < 10; i++ { w.Write([]byte("line\n")) }
+    close(done)
+  }()
+
+  select {
+  case <- done:
+  case <- time.After(2 * time.Second):
+    t.Fatal( "Expected writes not to block" )
+  }
+
+  close(buf.release)
+  w.Close()
+
+  if w.Dropped() < 7 { t.Fatalf("Expected at least 7 dropped lines, got %d", w.Dropped()) }
+  testAssertEqual(t, int64(10), w.Dropped() + int64(len(buf.String()) / 5))
+}
+
+
+type testFailingWriter struct {
+  bytes.Buffer
+  fail int
+}
+
+
+func (w *testFailingWriter) Write(p []byte) (int, error) {
+  if w.fail > 0 {
+    w.fail--
+    return 0, os.ErrInvalid
+  }
+  return w.Buffer.Write(p)
+}
+
+
+func TestAsyncWriterWriteError(t *testing.T) {
+  buf := &testFailingWriter{fail: 1}
+  w := NewAsyncWriter(buf, 4, time.Hour, BlockOnOverflow)
+
+  w.Write([]byte("lost\n"))
+  err := w.Flush()
+  if err == nil { t.Fatal( "Expected flush error" ) }
+  testAssertEqual(t, int64(1), w.Dropped())
+
+  w.Write([]byte("line\n"))
+  err = w.Flush()
+  if err != nil { t.Fatal( err ) }
+  w.Close()
+
+  testAssertEqual(t, int64(1), w.Dropped())
+  testAssertEqual(t, "line\n", buf.String())
+}
+
+
+func TestAsyncWriterBlock(t *testing.T) {
+  buf := &testSlowWriter{release: make(chan bool)}
+  w := NewAsyncWriter(buf, 1, time.Hour, BlockOnOverflow)
+
+  go func() {
+    time.Sleep(50 * time.Millisecond)
+    close(buf.release)
+  }()
+
+  for i := 0; i < 100; i++ { w.Write([]byte("line\n")) }
+  w.Close()
+
+  testAssertEqual(t, int64(0), w.Dropped())
+  testAssertEqual(t, 500, len(buf.String()))
+
+  _, err := w.Write([]byte("closed\n"))
+  if err == nil { t.Fatal( "Expected write error after close" ) }
+}
@@ -0,0 +1,158 @@
+package gosrv
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "sort"
+)
+
+
+// A command line subcommand, e.g. "myserver migrate". Run is called with the
+// configured Server and the command arguments. Commands with OnServe set run
+// when the server would start listening, once the app registered its
+// handlers, instead of from NewFromFlag. Flags, if set, are the options of
+// the command, parsed after its name alongside the global ones, e.g.
+// "myserver migrate -to 5". Their names must differ from the global ones.
+// Commands with BeforeLoad set run before the config is applied to the
+// Server, without opening log files or syslog connections; only s.Config
+// and s.PidFile are set.
+type Command struct {
+  Name       string
+  Usage      string
+  OnServe    bool
+  BeforeLoad bool
+  Flags      *FlagSet
+  Run        func(s *Server, args []string) error
+}
+
+
+// Map of command names to commands. Apps may add their own with
+// RegisterCommand.
+var Commands = map[string]*Command{}
+
+
+var serverCommands = []Command {
+  {Name: "start", Usage: "Start the server, as a daemon with -d", Run: cmdStart},
+  {Name: "stop", Usage: "Stop the running server, waiting up to -timeout", BeforeLoad: true, Run: cmdStop},
+  {Name: "restart", Usage: "Stop the running server and boot a daemon", BeforeLoad: true, Run: cmdRestart},
+  {Name: "status", Usage: "Show whether the server is running", BeforeLoad: true, Run: cmdStatus},
+  {Name: "config", Usage: "Validate or print config: config check|print [json]", BeforeLoad: true, Run: cmdConfig},
+  {Name: "routes", Usage: "List the registered routes", OnServe: true, Run: cmdRoutes},
+  {Name: "version", Usage: "Print version and build info", BeforeLoad: true, Run: cmdVersion},
+}
+
+
+// An error ending a command with the given exit status instead of 1, e.g.
+// 3 from the status command when the server isn't running.
+type ExitError struct {
+  Status  int
+  Message string
+}
+
+
+func (e *ExitError) Error() string {
+  return e.Message
+}
+
+
+// Adds a command line subcommand.
+func RegisterCommand(cmd Command) {
+  Commands[cmd.Name] = &cmd
+}
+
+
+func printCommands(w io.Writer) {
+  names := []string{}
+  for name, _ := range Commands { names = append(names, name) }
+  sort.Strings(names)
+
+  for _, name := range names {
+    fmt.Fprintf(w, "  %-10s %s\n", name, Commands[name].Usage) }
+}
+
+
+// Runs the command given on the command line if it should run at the
+// given time, and exits once it is done. The start command returns to
+// let the server boot.
+func (s *Server) runCommand(onServe bool) {
+  if s.cli == nil { return }
+
+  cmd := Commands[s.cli.command]
+  if cmd == nil || cmd.OnServe != onServe { return }
+
+  err := cmd.Run(s, s.cli.commandArgs)
+  if e, ok := err.(*ExitError); ok { exit(e.Status, "%s", e.Message) }
+  if err != nil { exit(1, err.Error()) }
+  if cmd.Name != "start" { os.Exit(0) }
+}
+
+
+func cmdStart(s *Server, args []string) error {
+  if s.cli.daemonizeServer { daemonize(s.cli.daemonArgs(s.cli.prog)) }
+  return nil
+}
+
+
+func cmdStop(s *Server, args []string) error {
+  fmt.Println("Stopping server...")
+
+  err := s.StopOther(s.cli.killServer, s.cli.timeout)
+  if err != nil { return err }
+
+  fmt.Println("\nServer stopped!")
+  return nil
+}
+
+
+func cmdRestart(s *Server, args []string) error {
+  err := cmdStop(s, args)
+  if err != nil { return err }
+
+  daemonize(s.cli.daemonArgs(s.cli.prog))
+  return nil
+}
+
+
+func cmdStatus(s *Server, args []string) error {
+  proc, err := findProcessAt(s.PidFile)
+  if err != nil { return &ExitError{3, fmt.Sprint("Server is not running. ", err)} }
+
+  fmt.Printf("Server is running (pid %d).\n", proc.Pid)
+  return nil
+}
+
+
+func cmdConfig(s *Server, args []string) error {
+  action := "print"
+  if len(args) > 0 { action = args[0] }
+
+  switch action {
+  case "check":
+    checkConfig(s.Config, s.cli.configErr)
+
+  case "print":
+    format := s.cli.printConfig
+    if len(args) > 1 { format = args[1] }
+    return s.Config.Print(os.Stdout, format)
+  }
+
+  return mkerr("Unknown config command %q.", action)
+}
+
+
+func cmdRoutes(s *Server, args []string) error {
+  for _, route := range s.Routes() { fmt.Println(route) }
+  return nil
+}
+
+
+func cmdVersion(s *Server, args []string) error {
+  fmt.Println(ReadBuildInfo())
+  return nil
+}
+
+
+func init() {
+  for _, cmd := range append(serverCommands, controlCommands...) { RegisterCommand(cmd) }
+}
@@ -0,0 +1,184 @@
+package gosrv
+
+import (
+  "testing"
+  "flag"
+  "io/ioutil"
+  "os"
+  "strings"
+  "net"
+  "net/http"
+)
+
+
+func TestParseFlagCommand(t *testing.T) {
+  fl, err := parseFlag([]string{"test", "start", "-d", "-e", "prod"})
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, "start", fl.command)
+  testAssertEqual(t, true, fl.daemonizeServer)
+  testAssertEqual(t, "prod", fl.env)
+
+  fl, err = parseFlag([]string{"test", "-e", "prod", "config", "check", "-c", "x.cfg"})
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, "config", fl.command)
+  testAssertEqual(t, "check", strings.Join(fl.commandArgs, " "))
+  testAssertEqual(t, "x.cfg", fl.configFile)
+
+  fl, err = parseFlag([]string{"test", "stop", "-timeout", "3s"})
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, "stop", fl.command)
+  testAssertEqual(t, "3s", fl.timeout.String())
+}
+
+
+func TestParseFlagLegacyCommand(t *testing.T) {
+  commands := map[string]string{
+    "": "start", "-d": "start", "-stop": "stop", "-kill": "stop",
+    "-restart": "restart", "-check-config": "config check",
+    "-print-config=json": "config print", "-version": "version",
+  }
+
+  for arg, cmd := range commands {
+    args := []string{"test"}
+    if arg != "" { args = append(args, arg) }
+
+    fl, err := parseFlag(args)
+    if err != nil { t.Fatal( err ) }
+    testAssertEqual(t, cmd, strings.Join(append([]string{fl.command}, fl.commandArgs...), " "))
+  }
+}
+
+
+func TestParseFlagUnknownCommand(t *testing.T) {
+  oldHandling := FlagErrorHandling
+  defer func(){ FlagErrorHandling = oldHandling }()
+  FlagErrorHandling = flag.ContinueOnError
+
+  _, err := parseFlag([]string{"test", "migrate"})
+  if err == nil { t.Fatal( "Expected error for unknown command" ) }
+
+  defer delete(Commands, "migrate")
+  RegisterCommand(Command{Name: "migrate", Usage: "Run migrations",
+    Run: func(s *Server, args []string) error { return nil }})
+
+  fl, err := parseFlag([]string{"test", "migrate", "up", "-e", "prod"})
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "migrate", fl.command)
+  testAssertEqual(t, "up", strings.Join(fl.commandArgs, " "))
+}
+
+
+func TestParseFlagCommandFlags(t *testing.T) {
+  oldHandling := FlagErrorHandling
+  defer func(){ FlagErrorHandling = oldHandling }()
+  FlagErrorHandling = flag.ContinueOnError
+
+  flags := NewFlagSet()
+  to := flags.Int("to", 0, "Target version")
+  flags.Bind("to", "migrateTo")
+
+  defer delete(Commands, "migrate")
+  RegisterCommand(Command{Name: "migrate", Usage: "Run migrations", Flags: flags,
+    Run: func(s *Server, args []string) error { return nil }})
+
+  fl, err := parseFlag([]string{"test", "-e", "prod", "migrate", "-to", "5", "up", "-a", ":80"})
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "migrate", fl.command)
+  testAssertEqual(t, "up", strings.Join(fl.commandArgs, " "))
+  testAssertEqual(t, 5, *to)
+  testAssertEqual(t, "5", fl.bound["migrateTo"])
+  testAssertEqual(t, "prod", fl.env)
+  testAssertEqual(t, ":80", fl.addr)
+
+  fl, err = parseFlag([]string{"test", "migrate", "up", "--", "-x", "down"})
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "up -x down", strings.Join(fl.commandArgs, " "))
+
+  // Command flags are only parsed after the command name.
+  _, err = parseFlag([]string{"test", "-to", "5", "migrate"})
+  if err == nil { t.Fatal( "Expected error for command flag before the command" ) }
+}
+
+
+func TestNewFromFlagBeforeLoad(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  file := dir + "/server.cfg"
+  ioutil.WriteFile(file, []byte("[DEFAULT]\nlogFile=" + dir + "/access.log\npidFile=" + dir + "/server.pid\n"), 0644)
+
+  // The command panics with the server to stop NewFromFlag before it exits.
+  defer delete(Commands, "peek")
+  RegisterCommand(Command{Name: "peek", BeforeLoad: true,
+    Run: func(s *Server, args []string) error { panic(s) }})
+
+  defer func() {
+    s, ok := recover().(*Server)
+    if !ok { t.Fatal( "Expected the command to run" ) }
+
+    testAssertEqual(t, dir + "/server.pid", s.PidFile)
+    testAssertEqual(t, true, s.logFile == nil)
+    _, err := os.Stat(dir + "/access.log")
+    testAssertEqual(t, true, os.IsNotExist(err))
+  }()
+
+  NewFromFlag("test", "peek", "-c", file)
+}
+
+
+func TestServeOnServeCommand(t *testing.T) {
+  defer delete(Commands, "peek")
+  RegisterCommand(Command{Name: "peek", OnServe: true,
+    Run: func(s *Server, args []string) error { panic(s) }})
+
+  l, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil { t.Fatal( err ) }
+  defer l.Close()
+
+  s := New()
+  s.PidFile = ""
+  s.cli = &parsedFlag{command: "peek"}
+
+  defer func() {
+    if _, ok := recover().(*Server); !ok { t.Fatal( "Expected the command to run" ) }
+  }()
+
+  s.Serve(l)
+}
+
+
+func TestCmdStatusNotRunning(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  s := New()
+  s.PidFile = dir + "/server.pid"
+
+  err := cmdStatus(s, nil)
+  e, ok := err.(*ExitError)
+  if !ok { t.Fatalf("Expected exit error, got %v", err) }
+  testAssertEqual(t, 3, e.Status)
+  testAssertEqual(t, true, strings.HasPrefix(e.Error(), "Server is not running."))
+}
+
+
+func TestDaemonArgs(t *testing.T) {
+  fl, err := parseFlag([]string{"path/to/test", "-d", "-e", "prod", "-stop",
+    "-set", "a=1", "-set", "b=2", "-timeout", "1s", "-a", ":80"})
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, "path/to/test start -a=:80 -e=prod -set a=1 -set b=2",
+    strings.Join(fl.daemonArgs(fl.prog), " "))
+}
+
+
+func TestMuxRoutes(t *testing.T) {
+  s := New()
+  s.HandleFunc("/users/", func(wr http.ResponseWriter, req *http.Request){})
+  s.Handle("/", http.NotFoundHandler())
+
+  testAssertEqual(t, "/ /users/", strings.Join(s.Routes(), " "))
+}
@@ -1,47 +1,297 @@
 package gosrv
 
 import (
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+  "unicode"
   "github.com/robfig/config"
 )
 
 
 // Environment-specific config for Server configuration and based on the
 // excellent config lib by robfig (github.com/robfig/config).
+//
+// Values are resolved in the following order, first match wins:
+//  1. Overrides given to Config.Set (command line flags)
+//  2. Environment variables named <EnvPrefix>_<KEY>, e.g. SERVER_READ_TIMEOUT
+//  3. The section named after Config.Env, e.g. [prod], followed by the
+//     sections it inherits from with an extends= key
+//  4. The [DEFAULT] section
+//  5. The Default of a key registered with RegisterConfigKey
+//
+// Values read from the config file may reference environment variables
+// with ${VAR} or ${VAR:-default}. Values of the form file:/path or @/path
+// are read from the given file, see Config.Secret.
 type Config struct {
   *config.Config
-  Env string
+  Env       string
+  EnvPrefix string
+  overrides map[string]string
+  file      string
+  sources   configSources
+  secrets   *secretCache
 }
 
 
 // Create a new config for a given environment.
 func NewConfig(env string) *Config {
-  return &Config{&config.Config{}, env}
+  return &Config{Config: config.NewDefault(), Env: env,
+    EnvPrefix: DefaultEnvPrefix, overrides: map[string]string{},
+    secrets: newSecretCache()}
 }
 
 
 // Create a new config by reading from a config file, for a given environment.
+// The file format is picked from ConfigLoaders by file extension.
 func ReadConfig(file, env string) (*Config, error) {
-  cfg, err := config.ReadDefault(file)
+  cfg, sources, err := loadConfigFile(file)
   if err != nil { return nil, err }
 
-  c := &Config{cfg, env}
+  c := &Config{Config: cfg, Env: env, EnvPrefix: DefaultEnvPrefix,
+    overrides: map[string]string{}, file: file, sources: sources,
+    secrets: newSecretCache()}
+  for _, section := range cfg.Sections() {
+    _, err = c.sectionChain(section)
+    if err != nil { return nil, fmt.Errorf("%s: %v", file, err) }
+  }
+
   return c, nil
 }
 
 
+// Set a config value that takes precedence over environment variables
+// and config file values.
+func (c *Config) Set(name, value string) {
+  if c.overrides == nil { c.overrides = map[string]string{} }
+  c.overrides[name] = value
+}
+
+
 // Get config value as String.
 func (c Config) String(name string) (string, error) {
-  return c.Config.String(c.Env, name)
+  val, _, err := c.lookup(name)
+  return val, err
+}
+
+
+// Returns where the value of the given key was resolved from: "flag",
+// "env:<VAR>", "[<section>]" or "default". Returns "" for unset keys.
+func (c Config) Source(name string) string {
+  _, src, err := c.lookup(name)
+  if err != nil { return "" }
+  return src
+}
+
+
+func (c Config) lookup(name string) (string, string, error) {
+  val, src, err := c.lookupRaw(name)
+  if err == nil && isSecretRef(val) { val, err = c.readSecretRef(name, src, val) }
+  if err != nil { return "", "", err }
+
+  return val, src, nil
+}
+
+
+func (c Config) lookupRaw(name string) (string, string, error) {
+  if val, ok := c.overrides[name]; ok { return val, "flag", nil }
+
+  if c.EnvPrefix != "" {
+    env := EnvVarName(c.EnvPrefix, name)
+    val, ok := os.LookupEnv(env)
+    if ok { return val, "env:" + env, nil }
+  }
+
+  chain, _ := c.sectionChain(c.Env)
+  for _, section := range chain {
+    if !c.sectionHas(section, name) { continue }
+
+    val, err := c.Config.String(section, name)
+    if err == nil { return expandVars(val), "[" + section + "]", nil }
+  }
+
+  val, err := c.Config.String(c.Env, name)
+  if err != nil {
+    if key, ok := ConfigKeys[name]; ok && key.Default != "" {
+      return key.Default, "default", nil }
+    return "", "", err
+  }
+
+  return expandVars(val), "[" + config.DEFAULT_SECTION + "]", nil
+}
+
+
+// Returns the given section followed by the sections it inherits from
+// with extends= keys. Stops at the first invalid or cyclic extends.
+func (c Config) sectionChain(section string) ([]string, error) {
+  chain := []string{section}
+
+  for c.sectionHas(section, "extends") {
+    parent, _ := c.RawString(section, "extends")
+    parent = strings.TrimSpace(parent)
+
+    if parent == config.DEFAULT_SECTION || !c.HasSection(parent) {
+      return chain, fmt.Errorf("[%s] extends unknown section [%s]", section, parent) }
+
+    for _, s := range chain {
+      if s == parent {
+        return chain, fmt.Errorf("[%s] extends cycle: %s -> %s",
+          chain[0], strings.Join(chain, " -> "), parent) }
+    }
+
+    chain = append(chain, parent)
+    section = parent
+  }
+
+  return chain, nil
+}
+
+
+func (c Config) sectionHas(section, name string) bool {
+  names, err := c.SectionOptions(section)
+  if err != nil { return false }
+
+  for _, n := range names {
+    if n == name { return true }
+  }
+  return false
 }
 
 
 // Get config value as Int.
 func (c Config) Int(name string) (int, error) {
-  return c.Config.Int(c.Env, name)
+  val, err := c.String(name)
+  if err != nil { return 0, err }
+
+  i, err := strconv.Atoi(strings.TrimSpace(val))
+  if err != nil { return 0, c.invalidValue("int", name, val) }
+
+  return i, nil
 }
 
 
 // Get config value as Bool.
 func (c Config) Bool(name string) (bool, error) {
-  return c.Config.Bool(c.Env, name)
+  val, err := c.String(name)
+  if err != nil { return false, err }
+
+  b, ok := boolValues[strings.ToLower(strings.TrimSpace(val))]
+  if !ok { return false, c.invalidValue("bool", name, val) }
+
+  return b, nil
+}
+
+
+// Get config value as a list of comma-separated values.
+func (c Config) List(name string) ([]string, error) {
+  val, err := c.String(name)
+  if err != nil { return nil, err }
+  return splitConfigList(val), nil
+}
+
+
+// Splits a comma-separated value, dropping blank items.
+func splitConfigList(val string) []string {
+  list := []string{}
+  for _, item := range strings.Split(val, ",") {
+    item = strings.TrimSpace(item)
+    if item != "" { list = append(list, item) }
+  }
+  return list
+}
+
+
+// Returns an error for an invalid value, without the value of secret keys.
+func (c Config) invalidValue(kind, name, val string) error {
+  if c.isSecret(name) { val = RedactedValue }
+  return mkerr("Invalid %s value %q for %s.", kind, val, name)
+}
+
+
+var boolValues = map[string]bool {
+  "1": true, "t": true, "true": true, "y": true, "yes": true, "on": true,
+  "0": false, "f": false, "false": false, "n": false, "no": false, "off": false,
+}
+
+
+// Returns the environment variable name that overrides the given config key,
+// e.g. EnvVarName("SERVER", "readTimeout") returns "SERVER_READ_TIMEOUT".
+func EnvVarName(prefix, name string) string {
+  key := envVarFormat(name)
+  if prefix == "" { return key }
+  return prefix + "_" + key
+}
+
+
+// Converts camelCase and punctuated names to UPPER_SNAKE_CASE.
+func envVarFormat(name string) string {
+  out := []rune{}
+  runes := []rune(name)
+
+  for i, r := range runes {
+    switch {
+    case unicode.IsUpper(r):
+      if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+        out = append(out, '_') }
+      out = append(out, r)
+    case unicode.IsLetter(r) || unicode.IsDigit(r):
+      out = append(out, unicode.ToUpper(r))
+    case len(out) > 0 && out[len(out)-1] != '_':
+      out = append(out, '_')
+    }
+  }
+
+  return strings.TrimRight(string(out), "_")
+}
+
+
+// Expands ${VAR} and ${VAR:-default} references to environment variables.
+// Unset variables without a default expand to an empty string.
+func expandVars(value string) string {
+  if !strings.Contains(value, "${") { return value }
+
+  out := ""
+  for {
+    start := strings.Index(value, "${")
+    if start < 0 { break }
+
+    end := matchingBrace(value, start+2)
+    if end < 0 { break }
+
+    out += value[:start] + lookupVar(value[start+2:end])
+    value = value[end+1:]
+  }
+
+  return out + value
+}
+
+
+func lookupVar(ref string) string {
+  name, def, hasDef := ref, "", false
+  if i := strings.Index(ref, ":-"); i >= 0 {
+    name, def, hasDef = ref[:i], ref[i+2:], true
+  }
+
+  if name == "" { return "${" + ref + "}" }
+
+  val, ok := os.LookupEnv(name)
+  if hasDef && (!ok || val == "") { return expandVars(def) }
+
+  return val
+}
+
+
+func matchingBrace(value string, from int) int {
+  depth := 1
+  for i := from; i < len(value); i++ {
+    switch value[i] {
+    case '{':
+      depth++
+    case '}':
+      depth--
+      if depth == 0 { return i }
+    }
+  }
+  return -1
 }
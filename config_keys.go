@@ -0,0 +1,332 @@
+package gosrv
+
+import (
+  "fmt"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+
+// Value type of a known config key.
+type ConfigType int
+
+const (
+  StringType ConfigType = iota
+  IntType
+  BoolType
+  DurationType
+)
+
+
+// Describes a config key known to the server or declared by the application.
+// Validate is optional and is called with the raw config value after the
+// value was checked against the key Type. Values of Secret keys are never
+// printed.
+type ConfigKey struct {
+  Name        string
+  Type        ConfigType
+  Description string
+  Default     string
+  Secret      bool
+  Validate    func(value string) error
+}
+
+
+// Registry of known config keys used by Config.Check.
+// Applications declare their own keys with RegisterConfigKey.
+var ConfigKeys = map[string]*ConfigKey{}
+
+
+var serverConfigKeys = []ConfigKey {
+  {Name: "include", Description: "Comma-separated config files to include"},
+  {Name: "extends", Description: "Section to inherit values from"},
+  {Name: "addr", Description: "The address to boot the server on"},
+  {Name: "pidFile", Description: "Location to store PID in"},
+  {Name: "readTimeout", Type: DurationType, Description: "Server read timeout"},
+  {Name: "writeTimeout", Type: DurationType, Description: "Server write timeout"},
+  {Name: "maxHeaderBytes", Type: IntType, Description: "Max header bytes allowed"},
+  {Name: "logFormat", Description: "Log format to write in"},
+  {Name: "logFile", Description: "File, syslog:// or journald target for request logs"},
+  {Name: "logMaxSize", Type: IntType, Description: "Rotate logFile above this size in megabytes"},
+  {Name: "logMaxAge", Type: DurationType, Description: "Remove rotated logs older than this"},
+  {Name: "logMaxBackups", Type: IntType, Description: "Number of rotated logs to keep"},
+  {Name: "logCompress", Type: BoolType, Description: "Gzip rotated logs"},
+  {Name: "logRotateDaily", Type: BoolType, Description: "Rotate logFile when the day changes"},
+  {Name: "logFilter", Description: "Requests to log, e.g. path!=/health, status>=500",
+    Validate: validateLogFilter},
+  {Name: "logSkip", Description: "Requests never logged, e.g. /health,ua:kube-probe",
+    Validate: validateLogSkip},
+  {Name: "logSample", Description: "Rates requests are logged at, e.g. 2xx:0.1",
+    Validate: validateLogSample},
+  {Name: "logSlowThreshold", Type: DurationType,
+    Description: "Requests this slow are logged despite logSkip and logSample"},
+  {Name: "log.*.file", Description: "File, syslog:// or journald target of the log sink"},
+  {Name: "log.*.format", Description: "Log format of the log sink"},
+  {Name: "log.*.encoding", Description: "Log line encoding of the log sink",
+    Validate: validateLogEncoding},
+  {Name: "log.*.fields", Description: "Fields written by the log sink json and logfmt encodings"},
+  {Name: "log.*.timeFormat", Description: "Time format of the log sink"},
+  {Name: "log.*.filter", Description: "Requests the log sink writes",
+    Validate: validateLogFilter},
+  {Name: "log.*.skip", Description: "Requests the log sink never writes",
+    Validate: validateLogSkip},
+  {Name: "log.*.sample", Description: "Rates the log sink writes requests at",
+    Validate: validateLogSample},
+  {Name: "log.*.async", Type: BoolType, Description: "Write the log sink in the background; logAsync if unset"},
+  {Name: "logAsync", Type: BoolType, Description: "Write request logs in the background"},
+  {Name: "logBufferSize", Type: IntType, Description: "Request log lines queued with logAsync"},
+  {Name: "logFlushInterval", Type: DurationType, Description: "How often logAsync lines are flushed"},
+  {Name: "logOverflow", Description: "When the logAsync queue is full: block or drop",
+    Validate: validateLogOverflow},
+  {Name: "errorLogFile", Description: "File or syslog target for server events and errors"},
+  {Name: "syslogFacility", Description: "Syslog facility, e.g. local0",
+    Validate: validateSyslogFacility},
+  {Name: "syslogTag", Description: "Syslog tag"},
+  {Name: "syslogSeverity", Description: "Syslog severity of log lines",
+    Validate: validateSyslogSeverity},
+  {Name: "logRedact", Type: BoolType, Description: "Redact sensitive data from request logs"},
+  {Name: "logRedactParams", Description: "Query parameters to redact from request logs"},
+  {Name: "logRedactHeaders", Description: "Headers to redact from request logs"},
+  {Name: "logRedactPattern.*", Description: "Regexp to redact from request logs, one per key",
+    Validate: validateLogRedactPattern},
+  {Name: "requestIdFormat", Description: "Format of generated request IDs: uuid4, ulid or ksuid",
+    Validate: validateRequestIdFormat},
+  {Name: "trustRequestIds", Description: "IPs or CIDRs whose X-Request-Id is kept, or *",
+    Validate: validateTrustRequestIds},
+  {Name: "slowRequestWarnAfter", Type: DurationType,
+    Description: "Log a warning event for requests still running after this"},
+  {Name: "slowRequestStacks", Type: BoolType,
+    Description: "Include the handler stack in slow request warnings"},
+  {Name: "logLevel", Description: "Minimum event level: debug, info, warn or error",
+    Validate: validateLogLevel},
+  {Name: "logEncoding", Description: "Log line encoding: text, json or logfmt",
+    Validate: validateLogEncoding},
+  {Name: "logFields", Description: "Comma-separated fields written by json and logfmt encodings"},
+  {Name: "timeFormat", Description: "Time format for logs"},
+  {Name: "certFile", Description: "TLS cert file"},
+  {Name: "keyFile", Description: "TLS key file"},
+}
+
+
+// Adds a key to the registry of known config keys. Keys with a Default
+// value resolve to it when no other config value is found.
+func RegisterConfigKey(key ConfigKey) {
+  ConfigKeys[key.Name] = &key
+}
+
+
+// A problem found in a config file by Config.Check. Section is empty for
+// values set with -set or bound flags.
+type ConfigError struct {
+  Section string
+  Key     string
+  Message string
+}
+
+
+func (e *ConfigError) Error() string {
+  if e.Section == "" { return fmt.Sprintf("flag %s: %s", e.Key, e.Message) }
+  return fmt.Sprintf("[%s] %s: %s", e.Section, e.Key, e.Message)
+}
+
+
+// Validates every section of the config and the values set with -set or
+// bound flags against the registry of known config keys. Returns an error
+// for each unknown key or invalid value.
+func (c Config) Check() []error {
+  errs := []error{}
+
+  for _, section := range c.Sections() {
+    names, err := c.SectionOptions(section)
+    if err != nil { continue }
+
+    for _, name := range names {
+      raw, err := c.RawString(section, name)
+      if err != nil { continue }
+
+      err = c.checkValue(section, name, raw)
+      if err != nil { errs = append(errs, err) }
+    }
+  }
+
+  names := []string{}
+  for name, _ := range c.overrides { names = append(names, name) }
+  sort.Strings(names)
+
+  for _, name := range names {
+    err := c.checkValue("", name, c.overrides[name])
+    if err != nil { errs = append(errs, err) }
+  }
+
+  return errs
+}
+
+
+// Returns a ConfigError for an unknown key or invalid value, without the
+// value of secret keys.
+func (c Config) checkValue(section, name, raw string) error {
+  err := checkConfigValue(name, raw)
+  if err == nil { return nil }
+
+  msg := err.Error()
+  if c.isSecret(name) && raw != "" {
+    msg = strings.Replace(msg, fmt.Sprintf("%q", raw), RedactedValue, -1)
+    msg = strings.Replace(msg, raw, RedactedValue, -1)
+  }
+  return &ConfigError{section, name, msg}
+}
+
+
+func checkConfigValue(name, value string) error {
+  key, ok := ConfigKeys[name]
+  if !ok { key, ok = ConfigKeys[wildcardConfigKey(name)] }
+  if !ok {
+    if guess := suggestConfigKey(name); guess != "" {
+      return fmt.Errorf("unknown key, did you mean %s?", guess) }
+    return fmt.Errorf("unknown key")
+  }
+
+  // Env var and secret file references can only be resolved at runtime.
+  if strings.Contains(value, "${") || isSecretRef(value) { return nil }
+
+  var err error
+  switch key.Type {
+  case IntType:
+    _, err = strconv.Atoi(strings.TrimSpace(value))
+    if err != nil { err = fmt.Errorf("%q is not an integer", value) }
+  case BoolType:
+    _, ok = boolValues[strings.ToLower(strings.TrimSpace(value))]
+    if !ok { err = fmt.Errorf("%q is not a boolean", value) }
+  case DurationType:
+    _, err = time.ParseDuration(value)
+    if err != nil { err = fmt.Errorf("%q is not a duration", value) }
+  }
+
+  if err == nil && key.Validate != nil { err = key.Validate(value) }
+  return err
+}
+
+
+// Returns the registry name of keys with a name segment, e.g. log.*.file
+// for log.json.file or logRedactPattern.* for logRedactPattern.card.
+func wildcardConfigKey(name string) string {
+  parts := strings.Split(name, ".")
+  switch len(parts) {
+  case 2: return parts[0] + ".*"
+  case 3: return parts[0] + ".*." + parts[2]
+  }
+  return name
+}
+
+
+// Returns the closest known config key name, or "" if none is close enough.
+func suggestConfigKey(name string) string {
+  names := []string{}
+  for n, _ := range ConfigKeys { names = append(names, n) }
+  sort.Strings(names)
+
+  best, bestDist := "", len(name)/3 + 2
+  for _, n := range names {
+    dist := editDistance(strings.ToLower(name), strings.ToLower(n))
+    if dist < bestDist { best, bestDist = n, dist }
+  }
+
+  return best
+}
+
+
+// Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+  prev := make([]int, len(b)+1)
+  curr := make([]int, len(b)+1)
+  for j := range prev { prev[j] = j }
+
+  for i := 1; i <= len(a); i++ {
+    curr[0] = i
+    for j := 1; j <= len(b); j++ {
+      cost := 1
+      if a[i-1] == b[j-1] { cost = 0 }
+      curr[j] = prev[j-1] + cost
+      if prev[j] + 1 < curr[j] { curr[j] = prev[j] + 1 }
+      if curr[j-1] + 1 < curr[j] { curr[j] = curr[j-1] + 1 }
+    }
+    prev, curr = curr, prev
+  }
+
+  return prev[len(b)]
+}
+
+
+func validateLogEncoding(val string) error {
+  if _, ok := logEncoders[val]; !ok && val != TextEncoding {
+    return fmt.Errorf("%q is not a log encoding", val) }
+  return nil
+}
+
+
+func validateLogLevel(val string) error {
+  _, err := ParseLogLevel(val)
+  return err
+}
+
+
+func validateLogFilter(val string) error {
+  _, err := ParseLogFilter(val)
+  return err
+}
+
+
+func validateLogSkip(val string) error {
+  _, err := NewSamplingFilter(splitConfigList(val), nil, 0)
+  return err
+}
+
+
+func validateLogSample(val string) error {
+  _, err := NewSamplingFilter(nil, splitConfigList(val), 0)
+  return err
+}
+
+
+func validateLogRedactPattern(val string) error {
+  _, err := NewLogRedactor(nil, nil, []string{val})
+  return err
+}
+
+
+func validateRequestIdFormat(val string) error {
+  if _, ok := RequestIdFormats[val]; !ok { return fmt.Errorf("%q is not a request ID format", val) }
+  return nil
+}
+
+
+func validateTrustRequestIds(val string) error {
+  _, err := parseIPNets(splitConfigList(val))
+  return err
+}
+
+
+func validateLogOverflow(val string) error {
+  if val != BlockOnOverflow && val != DropOnOverflow {
+    return fmt.Errorf("%q is not block or drop", val) }
+  return nil
+}
+
+
+func validateSyslogFacility(val string) error {
+  _, err := ParseSyslogFacility(val)
+  return err
+}
+
+
+func validateSyslogSeverity(val string) error {
+  _, err := ParseSyslogSeverity(val)
+  return err
+}
+
+
+func init() {
+  for _, key := range serverConfigKeys { RegisterConfigKey(key) }
+}
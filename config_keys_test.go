@@ -0,0 +1,113 @@
+package gosrv
+
+import (
+  "testing"
+  "fmt"
+)
+
+
+func TestConfigCheck(t *testing.T) {
+  c, err := ReadConfig("testdata/invalid.cfg", "dev")
+  if err != nil { t.Fatal( err ) }
+
+  errs := c.Check()
+  testAssertEqual(t, 3, len(errs))
+
+  testAssertEqual(t, "[DEFAULT] readTimout: unknown key, did you mean readTimeout?",
+    errs[0].Error())
+  testAssertEqual(t, "[DEFAULT] maxHeaderBytes: \"lots\" is not an integer",
+    errs[1].Error())
+  testAssertEqual(t, "[prod] certFlie: unknown key, did you mean certFile?",
+    errs[2].Error())
+}
+
+
+func TestConfigCheckFlags(t *testing.T) {
+  c := NewConfig("dev")
+  c.Set("readTimout", "5s")
+  c.Set("readTimeout", "abc")
+  c.Set("writeTimeout", "5s")
+  c.Set("dbPassword", "s3cr3t")
+
+  errs := c.Check()
+  testAssertEqual(t, 3, len(errs))
+
+  testAssertEqual(t, "flag dbPassword: unknown key", errs[0].Error())
+  testAssertEqual(t, "flag readTimeout: \"abc\" is not a duration", errs[1].Error())
+  testAssertEqual(t, "flag readTimout: unknown key, did you mean readTimeout?", errs[2].Error())
+}
+
+
+func TestConfigCheckAppKeys(t *testing.T) {
+  c, err := ReadConfig("testdata/server.cfg", "dev")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, 2, len(c.Check()))
+
+  defer delete(ConfigKeys, "customConfig")
+  defer delete(ConfigKeys, "dataDir")
+
+  RegisterConfigKey(ConfigKey{Name: "dataDir", Description: "Data directory"})
+  RegisterConfigKey(ConfigKey{Name: "customConfig",
+    Validate: func(val string) error {
+      if val != "customValue" { return fmt.Errorf("bad value") }
+      return nil
+    }})
+
+  testAssertEqual(t, 0, len(c.Check()))
+
+  c.AddOption("prod", "customConfig", "other")
+  errs := c.Check()
+  testAssertEqual(t, 1, len(errs))
+  testAssertEqual(t, "[prod] customConfig: bad value", errs[0].Error())
+}
+
+
+func TestConfigKeyDefault(t *testing.T) {
+  c := NewConfig("dev")
+
+  _, err := c.String("workers")
+  if err == nil { t.Fatal( "Value workers should not be set" ) }
+
+  defer delete(ConfigKeys, "workers")
+  RegisterConfigKey(ConfigKey{Name: "workers", Type: IntType, Default: "4"})
+
+  val, err := c.Int("workers")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, 4, val)
+}
+
+
+func TestSuggestConfigKey(t *testing.T) {
+  testAssertEqual(t, "writeTimeout", suggestConfigKey("writetimeout"))
+  testAssertEqual(t, "pidFile", suggestConfigKey("pidfle"))
+  testAssertEqual(t, "", suggestConfigKey("somethingElse"))
+}
+
+
+func TestConfigCheckLogSinkKeys(t *testing.T) {
+  c := NewConfig("dev")
+  c.AddOption("DEFAULT", "log.json.file", "access.json")
+  c.AddOption("DEFAULT", "log.json.filter", "size>1")
+  c.AddOption("DEFAULT", "log.json.fomat", "$Status")
+
+  errs := c.Check()
+  testAssertEqual(t, 2, len(errs))
+  testAssertEqual(t, "[DEFAULT] log.json.filter: unknown log filter field \"size\"",
+    errs[0].Error())
+  testAssertEqual(t, "[DEFAULT] log.json.fomat: unknown key, did you mean log.*.format?",
+    errs[1].Error())
+}
+
+
+func TestConfigCheckLogSampleKeys(t *testing.T) {
+  c := NewConfig("dev")
+  c.AddOption("DEFAULT", "logSkip", "/health, ua:kube-probe")
+  c.AddOption("DEFAULT", "logSample", "2xx:1.5")
+  c.AddOption("DEFAULT", "log.json.skip", "health")
+
+  errs := c.Check()
+  testAssertEqual(t, 2, len(errs))
+  testAssertEqual(t, "[DEFAULT] logSample: log sample rule \"2xx:1.5\" rate must be from 0 to 1",
+    errs[0].Error())
+  testAssertEqual(t, "[DEFAULT] log.json.skip: invalid log rule \"health\"", errs[1].Error())
+}
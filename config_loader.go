@@ -0,0 +1,277 @@
+package gosrv
+
+import (
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+  "github.com/BurntSushi/toml"
+  "github.com/robfig/config"
+)
+
+
+// Reads a config file into sections of key/value pairs. Values shared by all
+// environments go in the config.DEFAULT_SECTION section, and environment
+// specific values in a section named after the environment.
+type ConfigLoader interface {
+  Load(file string) (*config.Config, error)
+}
+
+
+// Adapter to use an ordinary function as a ConfigLoader.
+type ConfigLoaderFunc func(file string) (*config.Config, error)
+
+
+func (f ConfigLoaderFunc) Load(file string) (*config.Config, error) {
+  return f(file)
+}
+
+
+// Map of config file extensions to loaders. More may be added at need.
+// Files with other extensions are read as INI files.
+var ConfigLoaders = map[string]ConfigLoader {
+  ".cfg": ConfigLoaderFunc(config.ReadDefault),
+  ".ini": ConfigLoaderFunc(config.ReadDefault),
+  ".json": ConfigLoaderFunc(loadJSONConfig),
+  ".toml": ConfigLoaderFunc(loadTOMLConfig),
+}
+
+
+// The file each config value was read from, by section and key.
+type configSources map[[2]string]string
+
+
+// Reads a config file and the files it includes with a comma-separated
+// include= key in its DEFAULT section. Include paths are relative to the
+// including file, and values of the including file take precedence.
+// Also returns the file each value was read from.
+func loadConfigFile(file string) (*config.Config, configSources, error) {
+  sources := configSources{}
+  cfg, err := loadConfigIncludes(file, []string{}, sources)
+  return cfg, sources, err
+}
+
+
+func loadConfigIncludes(file string, stack []string, sources configSources) (*config.Config, error) {
+  path, err := filepath.Abs(file)
+  if err != nil { return nil, err }
+
+  for _, p := range stack {
+    if p == path {
+      return nil, fmt.Errorf("config include cycle: %s -> %s",
+        strings.Join(stack, " -> "), path) }
+  }
+
+  loader, ok := ConfigLoaders[strings.ToLower(filepath.Ext(file))]
+  if !ok { loader = ConfigLoaderFunc(config.ReadDefault) }
+
+  cfg, err := loader.Load(file)
+  if err != nil { return nil, err }
+
+  includes, err := cfg.RawString(config.DEFAULT_SECTION, "include")
+  if err != nil {
+    sources.add(cfg, file)
+    return cfg, nil
+  }
+  cfg.RemoveOption(config.DEFAULT_SECTION, "include")
+
+  merged := config.NewDefault()
+  for _, inc := range strings.Split(expandVars(includes), ",") {
+    inc = strings.TrimSpace(inc)
+    if inc == "" { continue }
+    if !filepath.IsAbs(inc) { inc = filepath.Join(filepath.Dir(file), inc) }
+
+    sub, err := loadConfigIncludes(inc, append(stack, path), sources)
+    if err != nil {
+      if len(stack) == 0 { err = fmt.Errorf("%s: %v", file, err) }
+      return nil, err
+    }
+    mergeConfig(merged, sub)
+  }
+
+  // Values of the including file replace those of its includes.
+  sources.add(cfg, file)
+  mergeConfig(merged, cfg)
+  return merged, nil
+}
+
+
+// Records file as the source of all values of cfg.
+func (sources configSources) add(cfg *config.Config, file string) {
+  for _, section := range cfg.Sections() {
+    names, _ := cfg.SectionOptions(section)
+    for _, name := range names { sources[[2]string{section, name}] = file }
+  }
+}
+
+
+// Copies all raw values of src into dst, replacing existing values.
+func mergeConfig(dst, src *config.Config) {
+  for _, section := range src.Sections() {
+    dst.AddSection(section)
+
+    names, _ := src.SectionOptions(section)
+    for _, name := range names {
+      val, err := src.RawString(section, name)
+      if err == nil { dst.AddOption(section, name, val) }
+    }
+  }
+}
+
+
+// Reads a JSON config file. A top-level "default" object holds [DEFAULT]
+// values and other top-level objects hold environment sections, e.g.:
+//  {"default": {"addr": ":9000"}, "prod": {"readTimeout": "2s"}}
+// Top-level scalar values are added to [DEFAULT]. Nested objects are
+// flattened into dotted keys and arrays into comma-separated values.
+func loadJSONConfig(file string) (*config.Config, error) {
+  f, err := os.Open(file)
+  if err != nil { return nil, err }
+  defer f.Close()
+
+  data := map[string]interface{}{}
+  dec := json.NewDecoder(f)
+  dec.UseNumber()
+
+  err = dec.Decode(&data)
+  if err != nil { return nil, fmt.Errorf("%s: %v", file, err) }
+
+  return configFromMap(data), nil
+}
+
+
+// Returns a config of the given top-level values and objects, adding
+// values to [DEFAULT] and objects as sections.
+func configFromMap(data map[string]interface{}) *config.Config {
+  cfg := config.NewDefault()
+  for _, name := range sortedKeys(data) {
+    obj, ok := data[name].(map[string]interface{})
+    if !ok {
+      addConfigValue(cfg, config.DEFAULT_SECTION, name, data[name])
+      continue
+    }
+
+    section := configSection(name)
+    cfg.AddSection(section)
+    for _, key := range sortedKeys(obj) { addConfigValue(cfg, section, key, obj[key]) }
+  }
+
+  return cfg
+}
+
+
+func addConfigValue(cfg *config.Config, section, key string, val interface{}) {
+  switch v := val.(type) {
+  case nil:
+  case map[string]interface{}:
+    for _, k := range sortedKeys(v) { addConfigValue(cfg, section, key+"."+k, v[k]) }
+  case []interface{}:
+    cfg.AddOption(section, key, strings.Join(configListItems(nil, v), ","))
+  default:
+    cfg.AddOption(section, key, configScalar(v))
+  }
+}
+
+
+// Appends the items of a possibly nested array.
+func configListItems(items []string, list []interface{}) []string {
+  for _, item := range list {
+    if l, ok := item.([]interface{}); ok {
+      items = configListItems(items, l)
+    } else {
+      items = append(items, configScalar(item))
+    }
+  }
+  return items
+}
+
+
+// Formats a value, writing TOML dates and times the way TOML does.
+func configScalar(val interface{}) string {
+  t, ok := val.(time.Time)
+  if !ok { return fmt.Sprint(val) }
+
+  switch t.Location().String() {
+  case "datetime-local": return t.Format("2006-01-02T15:04:05.999999999")
+  case "date-local": return t.Format("2006-01-02")
+  case "time-local": return t.Format("15:04:05.999999999")
+  }
+  return t.Format(time.RFC3339Nano)
+}
+
+
+func configSection(name string) string {
+  if strings.EqualFold(name, config.DEFAULT_SECTION) { return config.DEFAULT_SECTION }
+  return name
+}
+
+
+func sortedKeys(m map[string]interface{}) []string {
+  keys := []string{}
+  for k, _ := range m { keys = append(keys, k) }
+  sort.Strings(keys)
+  return keys
+}
+
+
+// Reads a TOML config file. Keys before the first table and in a [default]
+// table hold [DEFAULT] values, other tables hold environment sections.
+// Sub-tables such as [prod.tls] and inline tables are flattened into dotted
+// keys and arrays into comma-separated values. Arrays of tables are not
+// supported.
+func loadTOMLConfig(file string) (*config.Config, error) {
+  data, err := ioutil.ReadFile(file)
+  if err != nil { return nil, err }
+
+  values := map[string]interface{}{}
+  _, err = toml.Decode(string(data), &values)
+  if err != nil { return nil, fmt.Errorf("%s: %v", file, err) }
+
+  for _, name := range sortedKeys(values) {
+    key, ok := tomlTableArray(name, values[name])
+    if !ok {
+      return nil, fmt.Errorf("%s: unsupported TOML construct at line %d: array of tables %s",
+        file, tomlKeyLine(data, key), key) }
+  }
+
+  return configFromMap(values), nil
+}
+
+
+// Returns the key of the first array of tables in the given value and
+// false, or true if there is none.
+func tomlTableArray(key string, val interface{}) (string, bool) {
+  switch v := val.(type) {
+  case []map[string]interface{}:
+    return key, false
+  case map[string]interface{}:
+    for _, k := range sortedKeys(v) {
+      if key, ok := tomlTableArray(key+"."+k, v[k]); !ok { return key, false }
+    }
+  case []interface{}:
+    for _, item := range v {
+      if _, ok := item.(map[string]interface{}); ok { return key, false }
+      if key, ok := tomlTableArray(key, item); !ok { return key, false }
+    }
+  }
+  return key, true
+}
+
+
+// Returns the number of the line defining the given dotted key, or 0.
+func tomlKeyLine(data []byte, key string) int {
+  last := key[strings.LastIndex(key, ".")+1:]
+
+  for i, line := range strings.Split(string(data), "\n") {
+    line = strings.TrimSpace(line)
+    if strings.HasPrefix(line, "[[") && strings.Trim(line, "[] ") == key { return i + 1 }
+
+    name := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+    if strings.Contains(line, "=") && strings.Trim(name, `"'`) == last { return i + 1 }
+  }
+  return 0
+}
@@ -0,0 +1,79 @@
+package gosrv
+
+import (
+  "encoding/json"
+  "fmt"
+  "io"
+  "regexp"
+  "sort"
+  "text/tabwriter"
+  "github.com/robfig/config"
+)
+
+
+// Config keys matching this pattern have their values masked when printed.
+var SecretKeyPattern =
+  regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|private_?key|credential)`)
+
+// A resolved config value and where it was resolved from.
+type ConfigValue struct {
+  Key    string `json:"key"`
+  Value  string `json:"value"`
+  Source string `json:"source"`
+}
+
+
+// Config file directives, which aren't settings.
+var configDirectives = map[string]bool{"include": true, "extends": true}
+
+
+// Returns the effective config values for the current environment, sorted
+// by key, without the include and extends directives. Values of secret keys
+// are masked.
+func (c Config) Values() []ConfigValue {
+  names := map[string]bool{}
+
+  chain, _ := c.sectionChain(c.Env)
+  for _, section := range append(chain, config.DEFAULT_SECTION) {
+    opts, _ := c.SectionOptions(section)
+    for _, name := range opts { names[name] = true }
+  }
+  for name, _ := range c.overrides { names[name] = true }
+  for name, _ := range ConfigKeys { names[name] = true }
+
+  values := []ConfigValue{}
+  for name, _ := range names {
+    if configDirectives[name] { continue }
+
+    val, src, err := c.lookupRaw(name)
+    if err != nil { continue }
+    if c.isSecret(name) { val = RedactedValue }
+    values = append(values, ConfigValue{name, val, src})
+  }
+
+  sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+  return values
+}
+
+
+// Writes the effective config for the current environment to w, annotated
+// with the source of each value. Format may be "text" or "json".
+func (c Config) Print(w io.Writer, format string) error {
+  values := c.Values()
+
+  switch format {
+  case "json":
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(map[string]interface{}{"env": c.Env, "values": values})
+
+  case "text", "":
+    tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+    fmt.Fprintf(tw, "# env: %s\n", c.Env)
+    for _, v := range values {
+      fmt.Fprintf(tw, "%s=%s\t# %s\n", v.Key, v.Value, v.Source) }
+    return tw.Flush()
+  }
+
+  return mkerr("Unknown config print format %q.", format)
+}
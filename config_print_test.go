@@ -0,0 +1,74 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "encoding/json"
+  "strings"
+)
+
+
+func TestConfigValues(t *testing.T) {
+  c, err := ReadConfig("testdata/server.cfg", "prod")
+  if err != nil { t.Fatal( err ) }
+
+  c.Set("apiToken", "abc123")
+  c.Set("addr", ":7000")
+
+  values := map[string]ConfigValue{}
+  for _, v := range c.Values() { values[v.Key] = v }
+
+  testAssertEqual(t, ConfigValue{"addr", ":7000", "flag"}, values["addr"])
+  testAssertEqual(t, ConfigValue{"apiToken", RedactedValue, "flag"}, values["apiToken"])
+  testAssertEqual(t, ConfigValue{"writeTimeout", "1s", "[prod]"}, values["writeTimeout"])
+  testAssertEqual(t, ConfigValue{"readTimeout", "1s", "[DEFAULT]"}, values["readTimeout"])
+
+  _, ok := values["customConfig"]
+  testAssertEqual(t, true, ok)
+}
+
+
+func TestConfigValuesDirectives(t *testing.T) {
+  c, err := ReadConfig("testdata/include/app.cfg", "qa")
+  if err != nil { t.Fatal( err ) }
+
+  values := map[string]ConfigValue{}
+  for _, v := range c.Values() { values[v.Key] = v }
+
+  _, ok := values["extends"]
+  testAssertEqual(t, false, ok)
+  _, ok = values["include"]
+  testAssertEqual(t, false, ok)
+  testAssertEqual(t, ConfigValue{"pidFile", "path/to/staging.pid", "[staging]"}, values["pidFile"])
+}
+
+
+func TestConfigPrint(t *testing.T) {
+  c, err := ReadConfig("testdata/server.cfg", "prod")
+  if err != nil { t.Fatal( err ) }
+
+  buf := &bytes.Buffer{}
+  err = c.Print(buf, "text")
+  if err != nil { t.Fatal( err ) }
+
+  out := buf.String()
+  testAssertEqual(t, true, strings.HasPrefix(out, "# env: prod\n"))
+  testAssertEqual(t, true, strings.Contains(out, "writeTimeout=1s"))
+  testAssertEqual(t, true, strings.Contains(out, "# [prod]\n"))
+
+  buf.Reset()
+  err = c.Print(buf, "json")
+  if err != nil { t.Fatal( err ) }
+
+  data := struct{
+    Env    string
+    Values []ConfigValue
+  }{}
+  err = json.Unmarshal(buf.Bytes(), &data)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "prod", data.Env)
+  testAssertEqual(t, len(c.Values()), len(data.Values))
+
+  err = c.Print(buf, "yaml")
+  if err == nil { t.Fatal( "Expected unknown format error" ) }
+}
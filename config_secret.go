@@ -0,0 +1,140 @@
+package gosrv
+
+import (
+  "fmt"
+  "io"
+  "io/ioutil"
+  "path/filepath"
+  "strings"
+  "sync"
+)
+
+
+// Replaces secret values in config dumps and error messages.
+const RedactedValue = "[REDACTED]"
+
+
+// A config value that never prints its contents, e.g. with fmt or
+// encoding/json. Use Value to get the actual secret.
+type Secret struct {
+  value string
+}
+
+
+// Returns the secret value.
+func (s Secret) Value() string {
+  return s.value
+}
+
+
+func (s Secret) String() string {
+  return RedactedValue
+}
+
+
+func (s Secret) GoString() string {
+  return RedactedValue
+}
+
+
+func (s Secret) Format(f fmt.State, verb rune) {
+  io.WriteString(f, RedactedValue)
+}
+
+
+func (s Secret) MarshalText() ([]byte, error) {
+  return []byte(RedactedValue), nil
+}
+
+
+// Get config value as a Secret. Secret values are typically read from
+// files with the file:/path or @/path syntax.
+func (c Config) Secret(name string) (Secret, error) {
+  val, err := c.String(name)
+  return Secret{val}, err
+}
+
+
+// Returns true if the value of the given key should never be printed:
+// it is registered as a Secret key, its name matches SecretKeyPattern,
+// or its value is read from a file.
+func (c Config) isSecret(name string) bool {
+  if key, ok := ConfigKeys[name]; ok && key.Secret { return true }
+  if SecretKeyPattern.MatchString(name) { return true }
+
+  raw, _, err := c.lookupRaw(name)
+  return err == nil && isSecretRef(raw)
+}
+
+
+func isSecretRef(val string) bool {
+  return strings.HasPrefix(val, "file:") ||
+    strings.HasPrefix(val, "@/") || strings.HasPrefix(val, "@.")
+}
+
+
+// Secret file contents by config key, read once until the server is
+// reloaded.
+type secretCache struct {
+  lock   sync.Mutex
+  values map[string][2]string
+}
+
+
+func newSecretCache() *secretCache {
+  return &secretCache{values: map[string][2]string{}}
+}
+
+
+// Forgets the cached secrets, so they are read again from their files.
+func (sc *secretCache) clear() {
+  if sc == nil { return }
+
+  sc.lock.Lock()
+  sc.values = map[string][2]string{}
+  sc.lock.Unlock()
+}
+
+
+// Returns the secret referenced by a file:/path or @/path value found in
+// the given source, reading the file on first use of the key.
+func (c Config) readSecretRef(name, src, val string) (string, error) {
+  path := c.secretPath(name, src, val)
+  if c.secrets == nil { return readSecretFile(name, path) }
+
+  c.secrets.lock.Lock()
+  defer c.secrets.lock.Unlock()
+
+  // The cached value only applies while the key references the same file.
+  if cached, ok := c.secrets.values[name]; ok && cached[0] == path { return cached[1], nil }
+
+  secret, err := readSecretFile(name, path)
+  if err != nil { return "", err }
+
+  c.secrets.values[name] = [2]string{path, secret}
+  return secret, nil
+}
+
+
+// Returns the path of a file:/path or @/path value. Relative paths are
+// resolved from the directory of the config file that set the value, which
+// may be an included file, or of the main config file for flags and
+// environment variables.
+func (c Config) secretPath(name, src, val string) string {
+  path := strings.TrimPrefix(strings.TrimPrefix(val, "file:"), "@")
+  if filepath.IsAbs(path) { return path }
+
+  file := c.file
+  if f, ok := c.sources[[2]string{strings.Trim(src, "[]"), name}]; ok { file = f }
+  if file == "" { return path }
+
+  return filepath.Join(filepath.Dir(file), path)
+}
+
+
+func readSecretFile(name, path string) (string, error) {
+  bytes, err := ioutil.ReadFile(path)
+  if err != nil { return "", fmt.Errorf("could not read secret %s: %v", name, err) }
+
+  return strings.TrimRight(string(bytes), "\r\n"), nil
+}
@@ -0,0 +1,130 @@
+package gosrv
+
+import (
+  "testing"
+  "fmt"
+  "encoding/json"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+
+func TestConfigSecret(t *testing.T) {
+  c, err := ReadConfig("testdata/secrets.cfg", "prod")
+  if err != nil { t.Fatal( err ) }
+
+  s, err := c.Secret("dbPassword")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "s3cr3t", s.Value())
+
+  s, err = c.Secret("upstreamAuth")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "abc", s.Value())
+
+  val, err := c.String("handle")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "@someone", val)
+
+  _, err = c.String("missing")
+  if err == nil { t.Fatal( "Expected error for missing secret file" ) }
+}
+
+
+func TestConfigSecretCache(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  file := filepath.Join(dir, "token")
+  err := ioutil.WriteFile(file, []byte("first\n"), 0600)
+  if err != nil { t.Fatal( err ) }
+
+  cfg := NewConfig("dev")
+  cfg.Set("apiToken", "file:" + file)
+
+  s, err := cfg.Secret("apiToken")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "first", s.Value())
+
+  err = ioutil.WriteFile(file, []byte("second\n"), 0600)
+  if err != nil { t.Fatal( err ) }
+
+  s, err = cfg.Secret("apiToken")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "first", s.Value())
+
+  srv := New()
+  srv.Config = cfg
+  err = srv.Reload()
+  if err != nil { t.Fatal( err ) }
+
+  s, err = srv.CurrentConfig().Secret("apiToken")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "second", s.Value())
+}
+
+
+func TestConfigSecretInclude(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  os.Mkdir(filepath.Join(dir, "shared"), 0755)
+  ioutil.WriteFile(filepath.Join(dir, "app.cfg"), []byte("[DEFAULT]\ninclude=shared/db.cfg\n"), 0644)
+  ioutil.WriteFile(filepath.Join(dir, "shared", "db.cfg"), []byte("[DEFAULT]\ndbPassword=file:db_password\n"), 0644)
+  ioutil.WriteFile(filepath.Join(dir, "shared", "db_password"), []byte("included\n"), 0600)
+
+  // Relative paths resolve from the include that set the value.
+  c, err := ReadConfig(filepath.Join(dir, "app.cfg"), "prod")
+  if err != nil { t.Fatal( err ) }
+
+  s, err := c.Secret("dbPassword")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "included", s.Value())
+}
+
+
+func TestSecretNeverPrints(t *testing.T) {
+  s := Secret{"s3cr3t"}
+
+  for _, out := range []string{
+      fmt.Sprint(s), fmt.Sprintf("%s %v %q %#v %+v %x", s, s, s, s, &s, s),
+      fmt.Sprintf("%v", struct{ Pass Secret }{s}) } {
+    testAssertEqual(t, false, strings.Contains(out, "s3cr3t"))
+  }
+
+  b, err := json.Marshal(map[string]Secret{"pass": s})
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, `{"pass":"[REDACTED]"}`, string(b))
+}
+
+
+func TestSecretRedacted(t *testing.T) {
+  c, err := ReadConfig("testdata/secrets.cfg", "prod")
+  if err != nil { t.Fatal( err ) }
+
+  values := map[string]ConfigValue{}
+  for _, v := range c.Values() { values[v.Key] = v }
+
+  testAssertEqual(t, RedactedValue, values["dbPassword"].Value)
+  testAssertEqual(t, RedactedValue, values["upstreamAuth"].Value)
+  testAssertEqual(t, "@someone", values["handle"].Value)
+
+  _, err = c.Int("workers")
+  if err == nil { t.Fatal( "Expected error for invalid int" ) }
+  testAssertEqual(t, false, strings.Contains(err.Error(), "s3cr3t"))
+
+  c.Set("apiKey", "abc123")
+  _, err = c.Bool("apiKey")
+  if err == nil { t.Fatal( "Expected error for invalid bool" ) }
+  testAssertEqual(t, false, strings.Contains(err.Error(), "abc123"))
+
+  defer delete(ConfigKeys, "dbPassword")
+  RegisterConfigKey(ConfigKey{Name: "dbPassword", Secret: true,
+    Validate: func(val string) error { return fmt.Errorf("bad value %s", val) }})
+
+  c.AddOption("prod", "dbPassword", "plain")
+  for _, err := range c.Check() {
+    testAssertEqual(t, false, strings.Contains(err.Error(), "plain"))
+  }
+}
@@ -2,6 +2,9 @@ package gosrv
 
 import (
   "testing"
+  "io/ioutil"
+  "os"
+  "strings"
 )
 
 
@@ -43,3 +46,222 @@ func TestConfigEnv(t *testing.T) {
   if err != nil { t.Fatal( err ) }
   testAssertEqual(t, "1s", val)
 }
+
+
+func TestConfigEnvVar(t *testing.T) {
+  c, err := ReadConfig("testdata/server.cfg", "dev")
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, "GOSRV_TEST", c.EnvPrefix)
+
+  os.Setenv("GOSRV_TEST_WRITE_TIMEOUT", "3s")
+  defer os.Unsetenv("GOSRV_TEST_WRITE_TIMEOUT")
+
+  val, err := c.String("writeTimeout")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "3s", val)
+
+  c.EnvPrefix = "OTHER"
+
+  val, err = c.String("writeTimeout")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "500ms", val)
+}
+
+
+func TestConfigPrecedence(t *testing.T) {
+  c, err := ReadConfig("testdata/server.cfg", "dev")
+  if err != nil { t.Fatal( err ) }
+
+  val, _ := c.String("readTimeout")
+  testAssertEqual(t, "1s", val)
+
+  val, _ = c.String("writeTimeout")
+  testAssertEqual(t, "500ms", val)
+
+  os.Setenv("GOSRV_TEST_WRITE_TIMEOUT", "3s")
+  defer os.Unsetenv("GOSRV_TEST_WRITE_TIMEOUT")
+
+  val, _ = c.String("writeTimeout")
+  testAssertEqual(t, "3s", val)
+
+  c.Set("writeTimeout", "4s")
+
+  val, _ = c.String("writeTimeout")
+  testAssertEqual(t, "4s", val)
+}
+
+
+func TestConfigExpandVars(t *testing.T) {
+  c, err := ReadConfig("testdata/server.cfg", "dev")
+  if err != nil { t.Fatal( err ) }
+
+  os.Setenv("TEST_APP_NAME", "myapp")
+  defer os.Unsetenv("TEST_APP_NAME")
+
+  val, err := c.String("dataDir")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "/var/data/myapp", val)
+
+  os.Setenv("TEST_DATA_ROOT", "/tmp")
+  defer os.Unsetenv("TEST_DATA_ROOT")
+
+  val, err = c.String("dataDir")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "/tmp/myapp", val)
+
+  testAssertEqual(t, "$Status ${}", expandVars("$Status ${}"))
+  testAssertEqual(t, "myapp-b", expandVars("${TEST_UNSET_VAR:-${TEST_APP_NAME:-a}-b}"))
+}
+
+
+func TestEnvVarName(t *testing.T) {
+  testAssertEqual(t, "SERVER_READ_TIMEOUT", EnvVarName("SERVER", "readTimeout"))
+  testAssertEqual(t, "SERVER_MAX_HEADER_BYTES", EnvVarName("SERVER", "maxHeaderBytes"))
+  testAssertEqual(t, "SERVER_LOG_ACCESS_FILE", EnvVarName("SERVER", "log.access.file"))
+  testAssertEqual(t, "ADDR", EnvVarName("", "addr"))
+}
+
+
+func TestConfigSource(t *testing.T) {
+  c, err := ReadConfig("testdata/server.cfg", "dev")
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, "[DEFAULT]", c.Source("readTimeout"))
+  testAssertEqual(t, "[dev]", c.Source("writeTimeout"))
+  testAssertEqual(t, "", c.Source("certFile"))
+
+  os.Setenv("GOSRV_TEST_READ_TIMEOUT", "3s")
+  defer os.Unsetenv("GOSRV_TEST_READ_TIMEOUT")
+  testAssertEqual(t, "env:GOSRV_TEST_READ_TIMEOUT", c.Source("readTimeout"))
+
+  c.Set("readTimeout", "4s")
+  testAssertEqual(t, "flag", c.Source("readTimeout"))
+}
+
+
+func TestReadConfigFormats(t *testing.T) {
+  for _, file := range []string{"testdata/server.json", "testdata/server.toml"} {
+    c, err := ReadConfig(file, "dev")
+    if err != nil { t.Fatal( err ) }
+
+    val, _ := c.String("customConfig")
+    testAssertEqual(t, "customValue", val)
+
+    val, _ = c.String("writeTimeout")
+    testAssertEqual(t, "500ms", val)
+
+    num, _ := c.Int("maxHeaderBytes")
+    testAssertEqual(t, 1024, num)
+
+    _, err = c.String("certFile")
+    if err == nil { t.Fatal( "Value certFile should be empty in "+file ) }
+
+    c.Env = "prod"
+
+    val, _ = c.String("writeTimeout")
+    testAssertEqual(t, "1s", val)
+
+    val, _ = c.String("tls.minVersion")
+    testAssertEqual(t, "1.2", val)
+
+    val, _ = c.String("allowedHosts")
+    testAssertEqual(t, "a.example.com,b.example.com", val)
+    testAssertEqual(t, "[prod]", c.Source("allowedHosts"))
+    testAssertEqual(t, "[DEFAULT]", c.Source("addr"))
+  }
+}
+
+
+func TestReadConfigTOML(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  file := dir + "/server.toml"
+  ioutil.WriteFile(file, []byte(`
+logSkip = [
+  "/health",  # load balancer
+  "/metrics",
+]
+nested = [ 1, 2_000, [3, 4] ]
+started = 1979-05-27T07:32:00Z
+day = 1979-05-27
+motd = """
+Hello
+world"""
+
+[prod]
+tls = { minVersion = "1.2", ciphers = ['a', 'b'] }
+`), 0644)
+
+  c, err := ReadConfig(file, "prod")
+  if err != nil { t.Fatal( err ) }
+
+  for key, expected := range map[string]string{
+    "logSkip": "/health,/metrics",
+    "nested": "1,2000,3,4",
+    "started": "1979-05-27T07:32:00Z",
+    "day": "1979-05-27",
+    "motd": "Hello\nworld",
+    "tls.minVersion": "1.2",
+    "tls.ciphers": "a,b",
+  } {
+    val, _ := c.String(key)
+    testAssertEqual(t, expected, val)
+  }
+
+  ioutil.WriteFile(file, []byte("addr = \":9000\"\n\n[[servers]]\nname = \"a\"\n"), 0644)
+  _, err = ReadConfig(file, "prod")
+  if err == nil { t.Fatal( "Expected array of tables error" ) }
+  testAssertEqual(t, true, strings.Contains(err.Error(), "unsupported TOML construct at line 3"))
+
+  ioutil.WriteFile(file, []byte("addr = \n"), 0644)
+  _, err = ReadConfig(file, "prod")
+  if err == nil { t.Fatal( "Expected invalid TOML error" ) }
+}
+
+
+func TestReadConfigInclude(t *testing.T) {
+  c, err := ReadConfig("testdata/include/app.cfg", "prod")
+  if err != nil { t.Fatal( err ) }
+
+  val, _ := c.String("addr")
+  testAssertEqual(t, ":8080", val)
+
+  val, _ = c.String("certFile")
+  testAssertEqual(t, "path/to/server.cert", val)
+
+  val, _ = c.String("timeFormat")
+  testAssertEqual(t, "(02/01/2006 15:04:05)", val)
+
+  _, err = c.String("include")
+  if err == nil { t.Fatal( "Value include should have been removed" ) }
+
+  _, err = ReadConfig("testdata/include/cycle_a.cfg", "prod")
+  if err == nil { t.Fatal( "Expected include cycle error" ) }
+  testAssertEqual(t, true, strings.Contains(err.Error(), "include cycle"))
+  testAssertEqual(t, true, strings.HasSuffix(err.Error(), "cycle_a.cfg"))
+}
+
+
+func TestConfigExtends(t *testing.T) {
+  c, err := ReadConfig("testdata/include/app.cfg", "qa")
+  if err != nil { t.Fatal( err ) }
+
+  val, _ := c.String("pidFile")
+  testAssertEqual(t, "path/to/staging.pid", val)
+  testAssertEqual(t, "[staging]", c.Source("pidFile"))
+
+  val, _ = c.String("writeTimeout")
+  testAssertEqual(t, "1s", val)
+  testAssertEqual(t, "[prod]", c.Source("writeTimeout"))
+
+  val, _ = c.String("addr")
+  testAssertEqual(t, "[DEFAULT]", c.Source("addr"))
+
+  _, err = ReadConfig("testdata/include/extends_cycle.cfg", "prod")
+  if err == nil { t.Fatal( "Expected extends cycle error" ) }
+  testAssertEqual(t,
+    "testdata/include/extends_cycle.cfg: [prod] extends cycle: prod -> staging -> prod",
+    err.Error())
+}
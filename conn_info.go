@@ -0,0 +1,58 @@
+package gosrv
+
+import (
+  "context"
+  "io"
+  "net"
+  "sync/atomic"
+)
+
+
+var lastConnId uint64
+
+
+// Per connection state, used to log $ConnectionId and $ConnectionRequests.
+type connInfo struct {
+  id        uint64
+  requests  int64
+}
+
+type connInfoKey struct{}
+
+
+// Returns a context numbering the given connection and counting its
+// requests, for use as http.Server.ConnContext. Server sets it by default.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+  info := &connInfo{id: atomic.AddUint64(&lastConnId, 1)}
+  return context.WithValue(ctx, connInfoKey{}, info)
+}
+
+
+// Returns the connection ID and the number of this request on the
+// connection, counting from 1, or zeros without ConnContext.
+func nextConnRequest(ctx context.Context) (uint64, int64) {
+  info, ok := ctx.Value(connInfoKey{}).(*connInfo)
+  if !ok { return 0, 0 }
+  return info.id, atomic.AddInt64(&info.requests, 1)
+}
+
+
+// Counts the request body bytes read by the handler.
+type countingBody struct {
+  io.ReadCloser
+  read  int64
+}
+
+
+func (b *countingBody) Read(p []byte) (int, error) {
+  n, err := b.ReadCloser.Read(p)
+  atomic.AddInt64(&b.read, int64(n))
+  return n, err
+}
+
+
+// Returns the number of bytes read so far.
+func (b *countingBody) Bytes() int64 {
+  if b == nil { return 0 }
+  return atomic.LoadInt64(&b.read)
+}
@@ -0,0 +1,168 @@
+package gosrv
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "log"
+  "log/slog"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+
+// Severity of server events.
+type LogLevel int
+
+const (
+  DebugLevel LogLevel = iota
+  InfoLevel
+  WarnLevel
+  ErrorLevel
+)
+
+var logLevelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+
+func (lvl LogLevel) String() string {
+  if lvl < DebugLevel || lvl > ErrorLevel { return fmt.Sprintf("LEVEL(%d)", int(lvl)) }
+  return logLevelNames[lvl]
+}
+
+
+// Parses a log level name: debug, info, warn or error.
+func ParseLogLevel(name string) (LogLevel, error) {
+  upper := strings.ToUpper(strings.TrimSpace(name))
+  if upper == "WARNING" { upper = "WARN" }
+
+  for i, n := range logLevelNames {
+    if n == upper { return LogLevel(i), nil }
+  }
+  return InfoLevel, fmt.Errorf("%q is not a log level", name)
+}
+
+
+// Time format of event log lines.
+var DefaultEventTimeFormat = time.RFC3339
+
+
+// Leveled logger for server events and errors, such as the server
+// starting or stopping, kept apart from the access log. Lines are written
+// as "<time> <LEVEL> <message> [key=value...]", or sent to an slog.Logger.
+type EventLogger struct {
+  level   LogLevel
+  writer  io.Writer
+  slog    *slog.Logger
+  mutex   sync.RWMutex
+}
+
+
+func NewEventLogger(wr io.Writer) *EventLogger {
+  return &EventLogger{level: InfoLevel, writer: wr}
+}
+
+
+// Sets the minimum level of events to write.
+func (l *EventLogger) SetLevel(level LogLevel) {
+  l.mutex.Lock()
+  l.level = level
+  l.mutex.Unlock()
+}
+
+
+func (l *EventLogger) SetWriter(wr io.Writer) {
+  l.mutex.Lock()
+  l.writer = wr
+  l.mutex.Unlock()
+}
+
+
+// Sends events to the given slog.Logger instead of the writer, or back to
+// the writer if nil.
+func (l *EventLogger) SetSlogLogger(logger *slog.Logger) {
+  l.mutex.Lock()
+  l.slog = logger
+  l.mutex.Unlock()
+}
+
+
+// Returns true if events of the given level are written.
+func (l *EventLogger) Enabled(level LogLevel) bool {
+  l.mutex.RLock()
+  defer l.mutex.RUnlock()
+  return level >= l.level
+}
+
+
+// Writes an event of the given level.
+func (l *EventLogger) Logf(level LogLevel, format string, i ...interface{}) {
+  l.Log(level, strings.TrimRight(fmt.Sprintf(format, i...), "\n"))
+}
+
+
+// Writes an event of the given level with alternating key and value
+// attributes, e.g. l.Log(InfoLevel, "Server stopping", "addr", s.Addr).
+func (l *EventLogger) Log(level LogLevel, msg string, attrs ...interface{}) {
+  l.mutex.RLock()
+  wr := l.writer
+  logger := l.slog
+  enabled := level >= l.level
+  l.mutex.RUnlock()
+
+  if !enabled { return }
+
+  if logger != nil {
+    logger.Log(context.Background(), level.slogLevel(), msg, attrs...)
+    return
+  }
+  if wr == nil { return }
+
+  line := time.Now().Format(DefaultEventTimeFormat) + " " + level.String() + " " + msg
+  for i := 0; i + 1 < len(attrs); i += 2 {
+    val := fmt.Sprint(attrs[i+1])
+    if val == "" || strings.ContainsAny(val, " =\"") || needsEscape(val) { val = strconv.Quote(val) }
+    line += fmt.Sprintf(" %v=%s", attrs[i], val)
+  }
+  wr.Write([]byte(line + "\n"))
+}
+
+
+func (l *EventLogger) Debugf(format string, i ...interface{}) {
+  l.Logf(DebugLevel, format, i...)
+}
+
+
+func (l *EventLogger) Infof(format string, i ...interface{}) {
+  l.Logf(InfoLevel, format, i...)
+}
+
+
+func (l *EventLogger) Warnf(format string, i ...interface{}) {
+  l.Logf(WarnLevel, format, i...)
+}
+
+
+func (l *EventLogger) Errorf(format string, i ...interface{}) {
+  l.Logf(ErrorLevel, format, i...)
+}
+
+
+// Returns a standard library logger writing events of the given level,
+// e.g. for http.Server.ErrorLog.
+func (l *EventLogger) StdLogger(level LogLevel) *log.Logger {
+  return log.New(eventWriter{l, level}, "", 0)
+}
+
+
+type eventWriter struct {
+  logger  *EventLogger
+  level   LogLevel
+}
+
+
+func (w eventWriter) Write(p []byte) (int, error) {
+  w.logger.Logf(w.level, "%s", p)
+  return len(p), nil
+}
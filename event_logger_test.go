@@ -0,0 +1,49 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "strings"
+)
+
+
+func TestEventLogger(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewEventLogger(buf)
+
+  l.Debugf("hidden")
+  l.Infof("Server %s listening...\n", ":9000")
+  l.SetLevel(WarnLevel)
+  l.Infof("hidden")
+  l.Errorf("failed")
+
+  lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+  testAssertEqual(t, 2, len(lines))
+  testAssertEqual(t, true, strings.HasSuffix(lines[0], " INFO Server :9000 listening..."))
+  testAssertEqual(t, true, strings.HasSuffix(lines[1], " ERROR failed"))
+  testAssertEqual(t, false, l.Enabled(InfoLevel))
+}
+
+
+func TestEventLoggerStdLogger(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewEventLogger(buf)
+
+  l.StdLogger(ErrorLevel).Printf("http: TLS handshake error")
+  testAssertEqual(t, true, strings.HasSuffix(buf.String(), " ERROR http: TLS handshake error\n"))
+}
+
+
+func TestParseLogLevel(t *testing.T) {
+  levels := map[string]LogLevel{
+    "debug": DebugLevel, "INFO": InfoLevel, "warning": WarnLevel, " error ": ErrorLevel}
+
+  for name, expected := range levels {
+    level, err := ParseLogLevel(name)
+    if err != nil { t.Fatal( err ) }
+    testAssertEqual(t, expected, level)
+  }
+
+  _, err := ParseLogLevel("loud")
+  if err == nil { t.Fatal( "Expected unknown level error" ) }
+}
@@ -4,32 +4,159 @@ import (
   "fmt"
   "flag"
   "os"
+  "strings"
+  "time"
 )
 
 
+// Set FlagErrorHandling to flag.ContinueOnError to have NewFromFlag return
+// command line parse errors instead of exiting the process.
+var FlagErrorHandling = flag.ExitOnError
+
+
+// Application command line flags, parsed alongside the built-in gosrv flags
+// by NewFromFlag. Flags are defined with the usual flag.FlagSet methods, e.g.
+// gosrv.Flags.Int("workers", 4, "Number of workers").
+var Flags = NewFlagSet()
+
+
+// A set of application command line flags. Flags may be bound to config
+// keys, so that they override the config value when given.
+type FlagSet struct {
+  *flag.FlagSet
+  bindings map[string]string
+}
+
+
+// Creates a new, empty FlagSet.
+func NewFlagSet() *FlagSet {
+  return &FlagSet{flag.NewFlagSet(DefaultAppName, flag.ContinueOnError),
+    map[string]string{}}
+}
+
+
+// Binds the named flag to a config key. When the flag is given on the
+// command line, its value overrides the config value.
+func (fs *FlagSet) Bind(name, key string) {
+  fs.bindings[name] = key
+}
+
+
 type parsedFlag struct {
   daemonizeServer bool
   stopServer      bool
   restartServer   bool
   killServer      bool
+  checkConfig     bool
+  showVersion     bool
+  printConfig     string
   env             string
   addr            string
   configFile      string
   pidFile         string
+  timeout         time.Duration
+  prog            string
+  command         string
+  commandArgs     []string
+  configErr       error
+  settings        keyValues
+  bound           map[string]string
+  given           map[string]bool
   flagSet         *flag.FlagSet
 }
 
 
-func parseFlag(args []string) *parsedFlag {
-  f := parsedFlag{}
+func parseFlag(args []string) (*parsedFlag, error) {
+  f := parsedFlag{prog: args[0], bound: map[string]string{}, given: map[string]bool{}}
   f.setFlag(DefaultAppName)
-  f.flagSet.Parse(args[1:])
-  return &f
+
+  // Flags may be given before and after the command and its arguments.
+  // Those after the command may include its own flags, and those after --
+  // are passed to it as they are.
+  positional := []string{}
+  rest := args[1:]
+  var cmd *Command
+
+  err := f.flagSet.Parse(rest)
+  for err == nil && f.flagSet.NArg() > 0 {
+    next := f.flagSet.Args()
+    if len(rest) > len(next) && rest[len(rest)-len(next)-1] == "--" {
+      positional = append(positional, next...)
+      break
+    }
+
+    positional = append(positional, next[0])
+    if len(positional) == 1 {
+      cmd = Commands[next[0]]
+      if cmd != nil && cmd.Flags != nil {
+        cmd.Flags.VisitAll(func(fl *flag.Flag) { f.flagSet.Var(fl.Value, fl.Name, fl.Usage) }) }
+    }
+
+    rest = next[1:]
+    err = f.flagSet.Parse(rest)
+  }
+  if err != nil { return &f, err }
+
+  f.flagSet.Visit(func(fl *flag.Flag) {
+    f.given[fl.Name] = true
+    if key, ok := Flags.bindings[fl.Name]; ok { f.bound[key] = fl.Value.String() }
+    if cmd != nil && cmd.Flags != nil {
+      if key, ok := cmd.Flags.bindings[fl.Name]; ok { f.bound[key] = fl.Value.String() }
+    }
+  })
+
+  if len(positional) == 0 {
+    f.command, f.commandArgs = f.legacyCommand()
+  } else {
+    f.command, f.commandArgs = positional[0], positional[1:]
+  }
+
+  if _, ok := Commands[f.command]; !ok {
+    err = fmt.Errorf("unknown command %q", f.command)
+    fmt.Fprintln(f.flagSet.Output(), err)
+    f.flagSet.Usage()
+    if FlagErrorHandling == flag.ExitOnError { os.Exit(2) }
+  }
+
+  return &f, err
+}
+
+
+// Maps the legacy -stop, -restart, -kill, -check-config, -print-config and
+// -version flags to the equivalent command.
+func (f *parsedFlag) legacyCommand() (string, []string) {
+  switch {
+  case f.stopServer || f.killServer: return "stop", nil
+  case f.restartServer: return "restart", nil
+  case f.checkConfig: return "config", []string{"check"}
+  case f.printConfig != "": return "config", []string{"print"}
+  case f.showVersion: return "version", nil
+  }
+  return "start", nil
+}
+
+
+// Returns the command line to start a daemonized server with, built from
+// the explicitly given flags.
+func (f *parsedFlag) daemonArgs(prog string) []string {
+  args := []string{prog, "start"}
+
+  f.flagSet.Visit(func(fl *flag.Flag) {
+    switch fl.Name {
+    case "d", "stop", "restart", "kill", "timeout", "check-config", "print-config", "version":
+    case "set":
+      for _, pair := range f.settings { args = append(args, "-set", pair[0]+"="+pair[1]) }
+    default:
+      args = append(args, "-"+fl.Name+"="+fl.Value.String())
+    }
+  })
+
+  return args
 }
 
 
 func (f *parsedFlag) setFlag(name string) {
-  flagset := flag.NewFlagSet(name, flag.ExitOnError)
+  flagset := flag.NewFlagSet(name, FlagErrorHandling)
   flagset.StringVar(&f.addr, "a", DefaultAddr, "\tServer address")
   flagset.StringVar(&f.pidFile, "pid", DefaultPidFile, "\tServer PID File")
   flagset.StringVar(&f.configFile, "c", DefaultConfigFile, "\tConfig file")
@@ -41,12 +168,70 @@ func (f *parsedFlag) setFlag(name string) {
   flagset.BoolVar(&f.stopServer, "stop", false, "\tStop running server and exit")
   flagset.BoolVar(&f.restartServer, "restart", false, "\tStop running server and boot daemon")
   flagset.BoolVar(&f.killServer, "kill", false, "\tForce kill running server and exit")
+  flagset.DurationVar(&f.timeout, "timeout", 10 * time.Second, "\tTime to wait for the server to stop")
+  flagset.BoolVar(&f.checkConfig, "check-config", false, "\tValidate config file and exit")
+  flagset.Var(&optionalValue{&f.printConfig, "text"}, "print-config",
+    "\tPrint effective config and exit (=json for JSON output)")
+  flagset.BoolVar(&f.showVersion, "version", false, "\tPrint version and build info and exit")
+  flagset.Var(&f.settings, "set", "\tOverride a config value as key=value (repeatable)")
+
+  Flags.VisitAll(func(fl *flag.Flag) {
+    flagset.Var(fl.Value, fl.Name, fl.Usage)
+  })
 
   flagset.Usage = func() {
-    fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", name)
+    fmt.Fprintf(flagset.Output(), "Usage: %s [command] [options]\n\nCommands:\n", name)
+    printCommands(flagset.Output())
+    fmt.Fprintf(flagset.Output(), "\nOptions:\n")
     flagset.PrintDefaults()
-    os.Exit(2)
   }
 
   f.flagSet = flagset
 }
+
+
+// A string flag that may be given without a value, in which case
+// it is set to def, e.g. -print-config or -print-config=json.
+type optionalValue struct {
+  value *string
+  def   string
+}
+
+
+func (v *optionalValue) String() string {
+  if v.value == nil { return "" }
+  return *v.value
+}
+
+
+func (v *optionalValue) Set(s string) error {
+  if s == "true" { s = v.def }
+  if s == "false" { s = "" }
+  *v.value = s
+  return nil
+}
+
+
+func (v *optionalValue) IsBoolFlag() bool {
+  return true
+}
+
+
+// A repeatable key=value flag, e.g. -set readTimeout=2s -set addr=:80.
+type keyValues [][2]string
+
+
+func (kv *keyValues) String() string {
+  pairs := []string{}
+  for _, pair := range *kv { pairs = append(pairs, pair[0]+"="+pair[1]) }
+  return strings.Join(pairs, ",")
+}
+
+
+func (kv *keyValues) Set(s string) error {
+  i := strings.Index(s, "=")
+  if i < 1 { return fmt.Errorf("expected key=value but got %q", s) }
+
+  *kv = append(*kv, [2]string{strings.TrimSpace(s[:i]), s[i+1:]})
+  return nil
+}
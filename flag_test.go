@@ -3,6 +3,7 @@ package gosrv
 import (
   "testing"
   "os"
+  "flag"
 )
 
 
@@ -10,7 +11,8 @@ func TestParseFlag(t *testing.T) {
   args := []string{"test","-a",":7000","-pid","path/to/server.pid",
             "-c","path/to/server.cfg","-e","stage"}
 
-  fl := parseFlag(args)
+  fl, err := parseFlag(args)
+  if err != nil { t.Fatal( err ) }
 
   testAssertEqual(t, "stage", fl.env)
   testAssertEqual(t, ":7000", fl.addr)
@@ -31,7 +33,8 @@ func TestParseFlagForceProd(t *testing.T) {
   args := []string{"test","-a",":7000","-pid","path/to/server.pid",
             "-c","path/to/server.cfg"}
 
-  fl := parseFlag(args)
+  fl, err := parseFlag(args)
+  if err != nil { t.Fatal( err ) }
   testAssertEqual(t, "", fl.env)
 }
 
@@ -39,7 +42,8 @@ func TestParseFlagForceProd(t *testing.T) {
 func TestParseFlagDefaults(t *testing.T) {
   args := []string{"test"}
 
-  fl := parseFlag(args)
+  fl, err := parseFlag(args)
+  if err != nil { t.Fatal( err ) }
 
   testAssertEqual(t, "dev", fl.env)
   testAssertEqual(t, ":9000", fl.addr)
@@ -48,3 +52,75 @@ func TestParseFlagDefaults(t *testing.T) {
   testAssertEqual(t, false, fl.stopServer)
   testAssertEqual(t, false, fl.restartServer)
 }
+
+
+func TestParseFlagPrintConfig(t *testing.T) {
+  fl, _ := parseFlag([]string{"test"})
+  testAssertEqual(t, "", fl.printConfig)
+
+  fl, _ = parseFlag([]string{"test", "-print-config", "-e", "prod"})
+  testAssertEqual(t, "text", fl.printConfig)
+  testAssertEqual(t, "prod", fl.env)
+
+  fl, _ = parseFlag([]string{"test", "-print-config=json"})
+  testAssertEqual(t, "json", fl.printConfig)
+}
+
+
+func TestParseFlagAppFlags(t *testing.T) {
+  oldFlags := Flags
+  defer func(){ Flags = oldFlags }()
+  Flags = NewFlagSet()
+
+  workers := Flags.Int("workers", 4, "Number of workers")
+  verbose := Flags.Bool("v", false, "Verbose output")
+  Flags.String("db", "localhost", "Database host")
+  Flags.Bind("workers", "workerCount")
+  Flags.Bind("db", "dbHost")
+
+  fl, err := parseFlag([]string{"test", "-workers", "8", "-v", "-e", "prod"})
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, 8, *workers)
+  testAssertEqual(t, true, *verbose)
+  testAssertEqual(t, "prod", fl.env)
+  testAssertEqual(t, "8", fl.bound["workerCount"])
+
+  _, ok := fl.bound["dbHost"]
+  testAssertEqual(t, false, ok)
+}
+
+
+func TestParseFlagContinueOnError(t *testing.T) {
+  oldHandling := FlagErrorHandling
+  defer func(){ FlagErrorHandling = oldHandling }()
+  FlagErrorHandling = flag.ContinueOnError
+
+  _, err := parseFlag([]string{"test", "-unknown"})
+  if err == nil { t.Fatal( "Expected error for unknown flag" ) }
+
+  _, err = NewFromFlag("test", "-a")
+  if err == nil { t.Fatal( "Expected error for missing flag value" ) }
+
+  _, err = parseFlag([]string{"test", "-h"})
+  testAssertEqual(t, flag.ErrHelp, err)
+}
+
+
+func TestParseFlagSettings(t *testing.T) {
+  fl, err := parseFlag([]string{"test", "-set", "readTimeout=2s",
+              "-set", "logFormat=$Status $Request", "-a", DefaultAddr})
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, 2, len(fl.settings))
+  testAssertEqual(t, [2]string{"readTimeout", "2s"}, fl.settings[0])
+  testAssertEqual(t, [2]string{"logFormat", "$Status $Request"}, fl.settings[1])
+
+  testAssertEqual(t, true, fl.given["a"])
+  testAssertEqual(t, true, fl.given["set"])
+  testAssertEqual(t, false, fl.given["pid"])
+
+  var kv keyValues
+  err = kv.Set("noValue")
+  if err == nil { t.Fatal( "Expected error for missing =" ) }
+}
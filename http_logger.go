@@ -4,24 +4,52 @@ import (
   "io"
   "net"
   "net/http"
+  "os"
+  "reflect"
   "time"
+  "strconv"
   "strings"
+  "sync"
   "fmt"
 )
 
-// Interface for value fetching functions. Time represents when the request
-// was received. The given ResponseWriter should always be a gosrv.Response
-// when used in a gosrv.Mux.
-type LogValueFunc func(time.Time, http.ResponseWriter, *http.Request)string;
+// Interface for value fetching functions. The LogContext holds the settings
+// of the logger. Time represents when the request was received. The given
+// ResponseWriter should always be a gosrv.Response when used in a gosrv.Mux.
+type LogValueFunc func(*LogContext, time.Time, http.ResponseWriter, *http.Request)string;
+
+// Value functions appending to the log line buffer instead of returning a
+// string, to avoid allocating on every request.
+type logAppendFunc func([]byte, *LogContext, time.Time, http.ResponseWriter, *http.Request)[]byte;
+
+// Logger settings passed to value fetching functions. Param is the
+// parameter of LogParamValueMap keywords, e.g. X-Foo for $Header[X-Foo].
+type LogContext struct {
+  TimeFormat string
+  Param      string
+  redactor   *LogRedactor
+}
 
-// Map of logFormat keywords to functions. More may be added at need.
+// Map of logFormat keywords to functions. More may be added at need, and
+// built-in ones replaced, before setting the log format of a logger.
 var LogValueMap = map[string]LogValueFunc {
   "$RemoteAddr": lvRemoteAddr,
   "$Protocol": lvProtocol,
   "$RequestTime": lvDuration,
+  "$RequestTimeMs": lvDurationMs,
+  "$RequestTimeSec": lvDurationSec,
   "$Time": lvRequestTime,
+  "$TimeUTC": lvRequestTimeUTC,
+  "$TimeISO8601": lvRequestTimeISO8601,
+  "$TimeUnix": lvRequestTimeUnix,
+  "$TimeUnixMs": lvRequestTimeUnixMs,
   "$RequestMethod": lvRequestMethod,
   "$BodyBytes": lvResponseBytes,
+  "$RequestBytes": lvRequestBytes,
+  "$ResponseHeaderBytes": lvResponseHeaderBytes,
+  "$TimeToFirstByte": lvTimeToFirstByte,
+  "$ConnectionId": lvConnectionId,
+  "$ConnectionRequests": lvConnectionRequests,
   "$RemoteUser": lvRemoteUser,
   "$RequestUri": lvRequestUri,
   "$RequestPath": lvRequestPath,
@@ -29,6 +57,62 @@ var LogValueMap = map[string]LogValueFunc {
   "$Status": lvResponseStatus,
   "$HttpReferer": lvReferer,
   "$HttpUserAgent": lvUserAgent,
+  "$RequestId": lvRequestId,
+}
+
+// Appending forms of the built-in LogValueMap functions, used to render
+// log lines without allocating for as long as their LogValueMap entry
+// hasn't been replaced.
+var logAppendFuncs = map[string]builtinLogValue {
+  "$RequestTime": {lvDuration, laDuration},
+  "$RequestTimeMs": {lvDurationMs, laDurationMs},
+  "$RequestTimeSec": {lvDurationSec, laDurationSec},
+  "$Time": {lvRequestTime, laRequestTime},
+  "$TimeUTC": {lvRequestTimeUTC, laRequestTimeUTC},
+  "$TimeISO8601": {lvRequestTimeISO8601, laRequestTimeISO8601},
+  "$TimeUnix": {lvRequestTimeUnix, laRequestTimeUnix},
+  "$TimeUnixMs": {lvRequestTimeUnixMs, laRequestTimeUnixMs},
+  "$BodyBytes": {lvResponseBytes, laResponseBytes},
+  "$RequestBytes": {lvRequestBytes, laRequestBytes},
+  "$ResponseHeaderBytes": {lvResponseHeaderBytes, laResponseHeaderBytes},
+  "$TimeToFirstByte": {lvTimeToFirstByte, laTimeToFirstByte},
+  "$ConnectionId": {lvConnectionId, laConnectionId},
+  "$ConnectionRequests": {lvConnectionRequests, laConnectionRequests},
+  "$Request": {lvRequestFirstLine, laRequestFirstLine},
+  "$Status": {lvResponseStatus, laResponseStatus},
+}
+
+type builtinLogValue struct {
+  value   LogValueFunc
+  append  logAppendFunc
+}
+
+
+// Map of parameterised logFormat keywords, used as $Header[X-Foo], to
+// functions. Missing values are logged as "-".
+var LogParamValueMap = map[string]LogValueFunc {
+  "$Header": lvHeader,
+  "$ResponseHeader": lvResponseHeader,
+  "$Cookie": lvCookie,
+  "$Query": lvQuery,
+  "$Env": lvEnv,
+}
+
+// LogValueMap keywords with numeric values, written as numbers by the
+// json log encoding.
+var NumericLogValues = map[string]bool {
+  "$RequestTime": true,
+  "$RequestTimeMs": true,
+  "$RequestTimeSec": true,
+  "$TimeUnix": true,
+  "$TimeUnixMs": true,
+  "$BodyBytes": true,
+  "$RequestBytes": true,
+  "$ResponseHeaderBytes": true,
+  "$TimeToFirstByte": true,
+  "$ConnectionId": true,
+  "$ConnectionRequests": true,
+  "$Status": true,
 }
 
 var DefaultLogFormat =
@@ -41,6 +125,9 @@ type HttpLogger interface {
   io.Writer
   SetLogFormat(format string)
   SetTimeFormat(time_format string)
+  SetLogEncoding(encoding string) error
+  SetLogFields(fields []string) error
+  SetRedactor(r *LogRedactor)
   SetWriter(wr io.Writer)
   Println(i ...interface{}) (int, error)
   Printf(format string, i ...interface{}) (int, error)
@@ -51,11 +138,50 @@ type HttpLogger interface {
 type httpLogger struct {
   logFormat   string
   timeFormat  string
-  keys        []string
+  encoding    string
+  tokens      []logToken
+  formatKeys  []string
+  fields      []string
+  values      map[string]logValue
+  redactor    *LogRedactor
   writer      io.Writer
+  mutex       sync.RWMutex
 }
 
 
+// A parsed log keyword.
+type logValue struct {
+  key      string
+  fn       LogValueFunc
+  append   logAppendFunc
+  param    string
+  redacted bool
+}
+
+
+// A compiled log format piece: either literal text or a keyword value.
+type logToken struct {
+  text   string
+  value  *logValue
+}
+
+
+// Reusable per request state, so logging doesn't allocate.
+type logBuffer struct {
+  buf      []byte
+  scratch  []byte
+  ends     []int
+  vals     [][]byte
+  ctx      LogContext
+}
+
+var logBufferPool = sync.Pool{New: func() interface{} {
+  return &logBuffer{buf: make([]byte, 0, 512)} }}
+
+// Buffers grown beyond this size aren't reused.
+const maxPooledLogBuffer = 64 << 10
+
+
 func NewHttpLogger(wr io.Writer, formats ...string) HttpLogger {
   log_format  := DefaultLogFormat
   time_format := DefaultTimeFormat
@@ -63,36 +189,130 @@ func NewHttpLogger(wr io.Writer, formats ...string) HttpLogger {
   if len(formats) > 0 { log_format = formats[0] }
   if len(formats) > 1 { time_format = formats[1] }
 
-  l := &httpLogger{timeFormat: time_format, writer: wr}
+  // Invalid DefaultRedactPatterns are reported when loading the config.
+  redactor, _ := DefaultLogRedactor()
+  l := &httpLogger{timeFormat: time_format, encoding: TextEncoding,
+    redactor: redactor, writer: wr}
   l.SetLogFormat(log_format)
   return l
 }
 
 
+// Compiles the log format into literal text and keyword tokens once,
+// matching the longest keyword at each $.
 func (l *httpLogger) SetLogFormat(log_format string) {
+  tokens := []logToken{}
   keys := []string{}
-  for k, _ := range LogValueMap {
-    if strings.Contains(log_format, k) {
-      keys = append(keys, k)
-    }
+  seen := map[string]bool{}
+  text := 0
+
+  for i := 0; i < len(log_format); i++ {
+    if log_format[i] != '$' { continue }
+
+    key := matchLogKey(log_format[i:])
+    if key == "" { continue }
+
+    if text < i { tokens = append(tokens, logToken{text: log_format[text:i]}) }
+    v := parseLogValue(key)
+    tokens = append(tokens, logToken{value: &v})
+
+    if !seen[key] { keys = append(keys, key) }
+    seen[key] = true
+    i += len(key) - 1
+    text = i + 1
+  }
+  if text < len(log_format) { tokens = append(tokens, logToken{text: log_format[text:]}) }
+  tokens = append(tokens, logToken{text: "\n"})
+
+  l.mutex.Lock()
+  for i := range tokens {
+    if v := tokens[i].value; v != nil { v.redacted = l.redactor.redactsKey(v.key) }
   }
   l.logFormat = log_format
-  l.keys = keys
+  l.tokens = tokens
+  l.formatKeys = keys
+  l.parseKeys()
+  l.mutex.Unlock()
+}
+
+
+// Parses the format and field keywords into value functions and parameters
+// once, so Log doesn't have to. The map is replaced rather than modified so
+// Log may read it without the lock. Must be called with the lock held.
+func (l *httpLogger) parseKeys() {
+  values := map[string]logValue{}
+  for _, k := range append(append([]string{}, l.formatKeys...), l.fields...) {
+    v := parseLogValue(k)
+    v.redacted = l.redactor.redactsKey(k)
+    values[k] = v
+  }
+  l.values = values
 }
 
 
 func (l *httpLogger) SetTimeFormat(time_format string) {
+  l.mutex.Lock()
   l.timeFormat = time_format
+  l.mutex.Unlock()
+}
+
+
+// Sets the log line encoding to "text", "json" or "logfmt". The text
+// encoding writes the log format, the others write the log fields.
+func (l *httpLogger) SetLogEncoding(encoding string) error {
+  if _, ok := logEncoders[encoding]; !ok && encoding != TextEncoding {
+    return mkerr("Unknown log encoding %q.", encoding) }
+
+  l.mutex.Lock()
+  l.encoding = encoding
+  l.mutex.Unlock()
+  return nil
+}
+
+
+// Sets the LogValueMap keywords written by the json and logfmt encodings,
+// with or without the leading $. Defaults to the keywords of the log format.
+func (l *httpLogger) SetLogFields(fields []string) error {
+  keys := []string{}
+  for _, f := range fields {
+    k := "$" + strings.TrimPrefix(strings.TrimSpace(f), "$")
+    if _, _, ok := parseLogKey(k); !ok { return mkerr("Unknown log field %q.", f) }
+    keys = append(keys, k)
+  }
+
+  l.mutex.Lock()
+  l.fields = keys
+  l.parseKeys()
+  l.mutex.Unlock()
+  return nil
+}
+
+
+// Sets the redactor applied to every log value, or nil to log values as
+// they are. Defaults to DefaultLogRedactor.
+func (l *httpLogger) SetRedactor(r *LogRedactor) {
+  l.mutex.Lock()
+  l.redactor = r
+  format := l.logFormat
+  l.mutex.Unlock()
+
+  l.SetLogFormat(format)
 }
 
 
 func (l *httpLogger) SetWriter(wr io.Writer) {
+  l.mutex.Lock()
   l.writer = wr
+  l.mutex.Unlock()
 }
 
 
 func (l *httpLogger) Write(bytes []byte) (int, error) {
-  return l.writer.Write(bytes)
+  l.mutex.RLock()
+  wr := l.writer
+  l.mutex.RUnlock()
+
+  return wr.Write(bytes)
 }
 
 
@@ -107,59 +327,228 @@ func (l *httpLogger) Println(i ...interface{}) (int, error) {
 
 
 func (l *httpLogger) Log(t time.Time, wr http.ResponseWriter, req *http.Request) {
-  repl := []string{}
+  lb := logBufferPool.Get().(*logBuffer)
+  buf := lb.buf[:0]
+
+  l.mutex.RLock()
+  lb.ctx.TimeFormat = l.timeFormat
+  lb.ctx.redactor = l.redactor
+  tokens := l.tokens
+  values := l.values
+  encoder, ok := logEncoders[l.encoding]
+  fields := l.fields
+  if len(fields) == 0 { fields = l.formatKeys }
+  l.mutex.RUnlock()
+
+  if ok {
+    scratch, ends := lb.scratch[:0], lb.ends[:0]
+    for _, k := range fields {
+      v := values[k]
+      scratch = v.appendTo(scratch, &lb.ctx, t, wr, req)
+      ends = append(ends, len(scratch))
+    }
+
+    vals, start := lb.vals[:0], 0
+    for _, end := range ends {
+      vals = append(vals, scratch[start:end])
+      start = end
+    }
+    buf = encoder(buf, fields, vals)
+    for i := range vals { vals[i] = nil }
+    lb.scratch, lb.ends, lb.vals = scratch, ends, vals
+
+  } else {
+    for i := range tokens {
+      if tokens[i].value == nil {
+        buf = append(buf, tokens[i].text...)
+      } else {
+        buf = tokens[i].value.appendTo(buf, &lb.ctx, t, wr, req)
+      }
+    }
+  }
+
+  l.Write(buf)
 
-  for _, k := range l.keys {
-    repl = append(repl, k, LogValueMap[k](t, wr, req))
+  if cap(buf) <= maxPooledLogBuffer && cap(lb.scratch) <= maxPooledLogBuffer {
+    lb.buf = buf
+    logBufferPool.Put(lb)
   }
+}
 
-  r := strings.NewReplacer(repl...)
-  line := r.Replace(l.logFormat) + "\n"
 
-  l.Write([]byte(line))
+func (v *logValue) get(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  if v.redacted { return RedactedValue }
+
+  ctx.Param = v.param
+  if v.fn != nil { return ctx.redactor.Redact(v.fn(ctx, t, wr, req)) }
+  return string(ctx.redactor.redactFrom(v.append(nil, ctx, t, wr, req), 0))
 }
 
 
+func (v *logValue) appendTo(buf []byte, ctx *LogContext, t time.Time,
+  wr http.ResponseWriter, req *http.Request) []byte {
+  if v.redacted { return append(buf, RedactedValue...) }
+
+  ctx.Param = v.param
+  start := len(buf)
+  if v.append != nil {
+    buf = v.append(buf, ctx, t, wr, req)
+  } else {
+    buf = append(buf, v.fn(ctx, t, wr, req)...)
+  }
+  return ctx.redactor.redactFrom(buf, start)
+}
+
+
+// Uses the appending form of built-in keywords unless LogValueMap
+// has a different function for them.
+func parseLogValue(key string) logValue {
+  fn, param, _ := parseLogKey(key)
+  v := logValue{key: key, fn: fn, param: param}
+
+  if la, ok := logAppendFuncs[key]; ok && sameLogValueFunc(fn, la.value) {
+    v.fn, v.append = nil, la.append }
+  return v
+}
+
+
+func sameLogValueFunc(a, b LogValueFunc) bool {
+  return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+
+// Returns the value function and parameter of a LogValueMap keyword or a
+// LogParamValueMap keyword with its parameter, e.g. $Header[X-Foo].
+func parseLogKey(key string) (LogValueFunc, string, bool) {
+  if fn, ok := LogValueMap[key]; ok { return fn, "", true }
+
+  i := strings.IndexByte(key, '[')
+  if i < 0 || !strings.HasSuffix(key, "]") { return nil, "", false }
 
-func lvRemoteAddr(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  fn, ok := LogParamValueMap[key[:i]]
+  return fn, key[i+1:len(key)-1], ok
+}
+
+
+// Returns the longest LogValueMap or LogParamValueMap keyword the given
+// string starts with, or "".
+func matchLogKey(s string) string {
+  match := ""
+  for k, _ := range LogValueMap {
+    if len(k) > len(match) && strings.HasPrefix(s, k) { match = k }
+  }
+  for k, _ := range LogParamValueMap {
+    if !strings.HasPrefix(s, k + "[") { continue }
+    end := strings.IndexByte(s, ']')
+    if end + 1 > len(match) { match = s[:end+1] }
+  }
+  return match
+}
+
+
+func lvRemoteAddr(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
   host, _, err := net.SplitHostPort(req.RemoteAddr)
   if err != nil { host = req.RemoteAddr }
   return host
 }
 
 
-func lvDuration(t time.Time, wr http.ResponseWriter, req *http.Request) string {
-  duration := time.Since(t) / time.Microsecond
-  return fmt.Sprintf("%d", duration)
+func laDuration(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  return strconv.AppendInt(buf, int64(time.Since(t) / time.Microsecond), 10)
+}
+
+
+func laDurationMs(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  return strconv.AppendFloat(buf, time.Since(t).Seconds() * 1000, 'f', 3, 64)
+}
+
+
+func laDurationSec(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  return strconv.AppendFloat(buf, time.Since(t).Seconds(), 'f', 3, 64)
 }
 
 
-func lvProtocol(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+func lvProtocol(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
   return req.Proto
 }
 
 
-func lvRequestTime(t time.Time, wr http.ResponseWriter, req *http.Request) string {
-  return t.Format(DefaultTimeFormat)
+func laRequestTime(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  return t.AppendFormat(buf, ctx.TimeFormat)
+}
+
+
+func laRequestTimeUTC(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  return t.UTC().AppendFormat(buf, ctx.TimeFormat)
+}
+
+
+func laRequestTimeISO8601(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  return t.AppendFormat(buf, time.RFC3339)
+}
+
+
+func laRequestTimeUnix(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  return strconv.AppendInt(buf, t.Unix(), 10)
+}
+
+
+func laRequestTimeUnixMs(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  return strconv.AppendInt(buf, t.UnixNano() / int64(time.Millisecond), 10)
 }
 
 
-func lvRequestMethod(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+func lvRequestMethod(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
   return req.Method
 }
 
 
-func lvResponseBytes(t time.Time, wr http.ResponseWriter, req *http.Request) string {
-  b := "-"
+func laResponseBytes(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  if res, ok := wr.(*Response); ok && res.ContentLength() != 0 {
+    return strconv.AppendInt(buf, int64(res.ContentLength()), 10) }
+  return append(buf, '-')
+}
+
+
+// Request body bytes read by the handler.
+func laRequestBytes(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
   if res, ok := wr.(*Response); ok {
-    b = fmt.Sprintf("%d", res.ContentLength())
-    if b == "0" { b = "-" }
-  }
-  return b
+    return strconv.AppendInt(buf, res.requestBody.Bytes(), 10) }
+  return append(buf, '-')
 }
 
 
-func lvRemoteUser(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+func laResponseHeaderBytes(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  if res, ok := wr.(*Response); ok {
+    return strconv.AppendInt(buf, int64(res.HeaderBytes()), 10) }
+  return append(buf, '-')
+}
+
+
+// Microseconds until the response headers were written, which is when the
+// handler returned if it never wrote.
+func laTimeToFirstByte(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  res, ok := wr.(*Response)
+  if !ok || res.headerTime.IsZero() { return laDuration(buf, ctx, t, wr, req) }
+  return strconv.AppendInt(buf, int64(res.headerTime.Sub(t) / time.Microsecond), 10)
+}
+
+
+func laConnectionId(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  if res, ok := wr.(*Response); ok && res.connId > 0 {
+    return strconv.AppendUint(buf, res.connId, 10) }
+  return append(buf, '-')
+}
+
+
+func laConnectionRequests(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  if res, ok := wr.(*Response); ok && res.connRequest > 0 {
+    return strconv.AppendInt(buf, res.connRequest, 10) }
+  return append(buf, '-')
+}
+
+
+func lvRemoteUser(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
   remoteUser := "-"
   if req.URL.User != nil && req.URL.User.Username() != "" {
     remoteUser = req.URL.User.Username()
@@ -170,35 +559,156 @@ func lvRemoteUser(t time.Time, wr http.ResponseWriter, req *http.Request) string
 }
 
 
-func lvRequestPath(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+func lvRequestPath(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
   return req.URL.Path
 }
 
 
-func lvRequestUri(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+func lvRequestUri(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
   return req.RequestURI
 }
 
 
-func lvRequestFirstLine(t time.Time, wr http.ResponseWriter, req *http.Request) string {
-  return lvRequestMethod(t, wr, req) + " " +
-          lvRequestUri(t, wr, req) + " " +
-          lvProtocol(t, wr, req)
+func laRequestFirstLine(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
+  buf = append(buf, req.Method...)
+  buf = append(buf, ' ')
+  buf = append(buf, req.RequestURI...)
+  buf = append(buf, ' ')
+  return append(buf, req.Proto...)
 }
 
 
-func lvResponseStatus(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+func laResponseStatus(buf []byte, ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) []byte {
   if res, ok := wr.(*Response); ok {
-    return fmt.Sprintf("%d", res.Status) }
-  return "-"
+    return strconv.AppendInt(buf, int64(res.Status), 10) }
+  return append(buf, '-')
 }
 
 
-func lvReferer(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+func lvReferer(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
   return req.Referer()
 }
 
 
-func lvUserAgent(t time.Time, wr http.ResponseWriter, req *http.Request) string {
+func lvUserAgent(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
   return req.UserAgent()
 }
+
+
+// LogValueMap forms of the appending value functions.
+func lvDuration(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laDuration(nil, ctx, t, wr, req))
+}
+
+
+func lvDurationMs(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laDurationMs(nil, ctx, t, wr, req))
+}
+
+
+func lvDurationSec(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laDurationSec(nil, ctx, t, wr, req))
+}
+
+
+func lvRequestTime(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laRequestTime(nil, ctx, t, wr, req))
+}
+
+
+func lvRequestTimeUTC(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laRequestTimeUTC(nil, ctx, t, wr, req))
+}
+
+
+func lvRequestTimeISO8601(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laRequestTimeISO8601(nil, ctx, t, wr, req))
+}
+
+
+func lvRequestTimeUnix(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laRequestTimeUnix(nil, ctx, t, wr, req))
+}
+
+
+func lvRequestTimeUnixMs(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laRequestTimeUnixMs(nil, ctx, t, wr, req))
+}
+
+
+func lvResponseBytes(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laResponseBytes(nil, ctx, t, wr, req))
+}
+
+
+func lvRequestBytes(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laRequestBytes(nil, ctx, t, wr, req))
+}
+
+
+func lvResponseHeaderBytes(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laResponseHeaderBytes(nil, ctx, t, wr, req))
+}
+
+
+func lvTimeToFirstByte(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laTimeToFirstByte(nil, ctx, t, wr, req))
+}
+
+
+func lvConnectionId(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laConnectionId(nil, ctx, t, wr, req))
+}
+
+
+func lvConnectionRequests(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laConnectionRequests(nil, ctx, t, wr, req))
+}
+
+
+func lvRequestFirstLine(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laRequestFirstLine(nil, ctx, t, wr, req))
+}
+
+
+func lvResponseStatus(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return string(laResponseStatus(nil, ctx, t, wr, req))
+}
+
+
+func lvRequestId(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return orDash(RequestId(req))
+}
+
+
+func lvHeader(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return orDash(req.Header.Get(ctx.Param))
+}
+
+
+func lvResponseHeader(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return orDash(wr.Header().Get(ctx.Param))
+}
+
+
+func lvCookie(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  cookie, err := req.Cookie(ctx.Param)
+  if err != nil { return "-" }
+  return orDash(cookie.Value)
+}
+
+
+func lvQuery(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return orDash(req.URL.Query().Get(ctx.Param))
+}
+
+
+func lvEnv(ctx *LogContext, t time.Time, wr http.ResponseWriter, req *http.Request) string {
+  return orDash(os.Getenv(ctx.Param))
+}
+
+
+func orDash(val string) string {
+  if val == "" { return "-" }
+  return val
+}
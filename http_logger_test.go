@@ -0,0 +1,345 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "strconv"
+  "time"
+)
+
+
+func testLogRequest(l HttpLogger, status int, body string) {
+  req := httptest.NewRequest("GET", "/path?q=1", nil)
+  req.RemoteAddr = "10.0.0.1:1234"
+  req.Header.Set("User-Agent", "agent \"quoted\"")
+
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  res.WriteHeader(status)
+  if body != "" { res.Write([]byte(body)) }
+
+  l.Log(time.Now(), res, req)
+}
+
+
+func TestHttpLoggerText(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf, "$RemoteAddr \"$Request\" $Status $BodyBytes")
+  testLogRequest(l, 200, "hello")
+
+  testAssertEqual(t, "10.0.0.1 \"GET /path?q=1 HTTP/1.1\" 200 5\n", buf.String())
+}
+
+
+func TestHttpLoggerJSON(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf)
+  err := l.SetLogEncoding("json")
+  if err != nil { t.Fatal( err ) }
+
+  testLogRequest(l, 404, "")
+
+  data := map[string]interface{}{}
+  err = json.Unmarshal(buf.Bytes(), &data)
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, 8, len(data))
+  testAssertEqual(t, "10.0.0.1", data["RemoteAddr"])
+  testAssertEqual(t, "GET /path?q=1 HTTP/1.1", data["Request"])
+  testAssertEqual(t, "agent \"quoted\"", data["HttpUserAgent"])
+  testAssertEqual(t, float64(404), data["Status"])
+  testAssertEqual(t, nil, data["BodyBytes"])
+
+  buf.Reset()
+  err = l.SetLogFields([]string{"Status", "$RequestTime", "RequestPath"})
+  if err != nil { t.Fatal( err ) }
+
+  testLogRequest(l, 200, "hello")
+
+  data = map[string]interface{}{}
+  err = json.Unmarshal(buf.Bytes(), &data)
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, 3, len(data))
+  testAssertEqual(t, "/path", data["RequestPath"])
+  _, ok := data["RequestTime"].(float64)
+  testAssertEqual(t, true, ok)
+
+  err = l.SetLogFields([]string{"Unknown"})
+  if err == nil { t.Fatal( "Expected unknown field error" ) }
+}
+
+
+func TestHttpLoggerLogfmt(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf, "$RemoteAddr $HttpReferer $Status $HttpUserAgent")
+  err := l.SetLogEncoding("logfmt")
+  if err != nil { t.Fatal( err ) }
+
+  testLogRequest(l, http.StatusCreated, "")
+  testAssertEqual(t,
+    "RemoteAddr=10.0.0.1 HttpReferer=\"\" Status=201 HttpUserAgent=\"agent \\\"quoted\\\"\"\n",
+    buf.String())
+
+  err = l.SetLogEncoding("xml")
+  if err == nil { t.Fatal( "Expected unknown encoding error" ) }
+}
+
+
+func TestHttpLoggerFormatKeys(t *testing.T) {
+  l := NewHttpLogger(nil, "$Request $RequestTime $RequestUri $Time $Request $Foo").(*httpLogger)
+  keys := l.formatKeys
+  testAssertEqual(t, 4, len(keys))
+  testAssertEqual(t, "$Request", keys[0])
+  testAssertEqual(t, "$RequestTime", keys[1])
+  testAssertEqual(t, "$RequestUri", keys[2])
+  testAssertEqual(t, "$Time", keys[3])
+}
+
+
+func TestAppendJSONString(t *testing.T) {
+  s := "a\"b\\c\n\x01é\xff"
+  out := appendJSONString(nil, []byte(s))
+
+  var val string
+  err := json.Unmarshal(out, &val)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "a\"b\\c\n\x01é�", val)
+}
+
+
+func TestAppendQuoted(t *testing.T) {
+  for _, s := range []string{"", "a b", "a\"b\\c\n\x01\x7fé\xff\u200b"} {
+    testAssertEqual(t, strconv.Quote(s), string(appendQuoted(nil, []byte(s))))
+  }
+}
+
+
+func TestIsJSONNumber(t *testing.T) {
+  for _, s := range []string{"0", "12", "-3", "1.500", "2e10", "-0.5E-3"} {
+    testAssertEqual(t, true, isJSONNumber([]byte(s)))
+  }
+  for _, s := range []string{"", "-", "01", "1.", ".5", "1e", "NaN", "+1", "12a"} {
+    testAssertEqual(t, false, isJSONNumber([]byte(s)))
+  }
+}
+
+
+func TestHttpLoggerTimeFormat(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf, "$Time|$TimeUTC|$TimeISO8601|$TimeUnix|$TimeUnixMs", "2006-01-02 15:04")
+
+  req := httptest.NewRequest("GET", "/", nil)
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  tm := time.Date(2020, 3, 4, 5, 6, 7, 8000000, time.FixedZone("X", 3600))
+  l.Log(tm, res, req)
+
+  testAssertEqual(t,
+    "2020-03-04 05:06|2020-03-04 04:06|2020-03-04T05:06:07+01:00|1583294767|1583294767008\n",
+    buf.String())
+}
+
+
+func TestHttpLoggerRequestTime(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf, "$RequestTimeSec $RequestTimeMs $RequestTime $Request")
+
+  req := httptest.NewRequest("GET", "/", nil)
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  l.Log(time.Now().Add(-1500 * time.Millisecond), res, req)
+
+  parts := bytes.SplitN(buf.Bytes(), []byte(" "), 4)
+  testAssertEqual(t, "1.5", string(parts[0][:3]))
+  testAssertEqual(t, "150", string(parts[1][:3]))
+  testAssertEqual(t, "150", string(parts[2][:3]))
+  testAssertEqual(t, "GET / HTTP/1.1\n", string(parts[3]))
+}
+
+
+func TestHttpLoggerTimeToFirstByte(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf, "$TimeToFirstByte $ResponseHeaderBytes $RequestBytes $ConnectionId")
+
+  req := httptest.NewRequest("GET", "/", nil)
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  res.Header().Set("X-A", "b")
+
+  start := time.Now().Add(-2 * time.Second)
+  res.WriteHeader(404)
+  l.Log(start, res, req)
+
+  parts := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte(" "))
+  testAssertEqual(t, "200", string(parts[0][:3]))
+  testAssertEqual(t, "34", string(parts[1]))
+  testAssertEqual(t, "0", string(parts[2]))
+  testAssertEqual(t, "-", string(parts[3]))
+}
+
+
+func TestHttpLoggerConnectionValues(t *testing.T) {
+  buf := &bytes.Buffer{}
+  m := NewMux()
+  m.Logger = NewHttpLogger(buf, "$ConnectionId $ConnectionRequests $RequestBytes $BodyBytes")
+  m.HandleFunc("/", func(wr http.ResponseWriter, req *http.Request) {
+    body, _ := ioutil.ReadAll(req.Body)
+    wr.Write(body)
+  })
+
+  ts := httptest.NewUnstartedServer(m)
+  ts.Config.ConnContext = ConnContext
+  ts.Start()
+  defer ts.Close()
+
+  for _, body := range []string{"hello", "", "hi"} {
+    res, err := http.Post(ts.URL, "text/plain", bytes.NewBufferString(body))
+    if err != nil { t.Fatal( err ) }
+    ioutil.ReadAll(res.Body)
+    res.Body.Close()
+  }
+
+  lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+  testAssertEqual(t, 3, len(lines))
+
+  id := string(bytes.Fields(lines[0])[0])
+  testAssertEqual(t, id + " 1 5 5", string(lines[0]))
+  testAssertEqual(t, id + " 2 0 -", string(lines[1]))
+  testAssertEqual(t, id + " 3 2 2", string(lines[2]))
+}
+
+
+func TestHttpLoggerParamValues(t *testing.T) {
+  os.Setenv("TEST_LOG_HOST", "web1")
+  defer os.Unsetenv("TEST_LOG_HOST")
+
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf,
+    "$Header[X-Tenant] $Header[X-Missing] $ResponseHeader[Content-Type] $Cookie[session] $Cookie[none] $Query[page] $Query[q] $Env[TEST_LOG_HOST] $Status")
+
+  req := httptest.NewRequest("GET", "/?page=2", nil)
+  req.Header.Set("X-Tenant", "acme")
+  req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  res.Header().Set("Content-Type", "text/plain")
+  res.WriteHeader(200)
+  l.Log(time.Now(), res, req)
+
+  testAssertEqual(t, "acme - text/plain abc - 2 - web1 200\n", buf.String())
+
+  buf.Reset()
+  err := l.SetLogEncoding("json")
+  if err != nil { t.Fatal( err ) }
+  err = l.SetLogFields([]string{"Header[X-Tenant]", "Status"})
+  if err != nil { t.Fatal( err ) }
+
+  l.Log(time.Now(), res, req)
+  testAssertEqual(t, "{\"Header[X-Tenant]\":\"acme\",\"Status\":200}\n", buf.String())
+
+  err = l.SetLogFields([]string{"Unknown[X]"})
+  if err == nil { t.Fatal( "Expected unknown field error" ) }
+}
+
+
+func TestHttpLoggerFormatParamKeys(t *testing.T) {
+  l := NewHttpLogger(nil, "$Header[X-A] $ResponseHeader[X-A] $Header[ $Status").(*httpLogger)
+  keys := l.formatKeys
+  testAssertEqual(t, 3, len(keys))
+  testAssertEqual(t, "$Header[X-A]", keys[0])
+  testAssertEqual(t, "$ResponseHeader[X-A]", keys[1])
+  testAssertEqual(t, "$Status", keys[2])
+}
+
+
+func TestHttpLoggerOverlappingKeys(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf, "$Request|$RequestUri|$RequestMethod|$Requests|$$Status")
+  testLogRequest(l, 200, "")
+
+  testAssertEqual(t, "GET /path?q=1 HTTP/1.1|/path?q=1|GET|GET /path?q=1 HTTP/1.1s|$200\n", buf.String())
+}
+
+
+func TestHttpLoggerReplacedValue(t *testing.T) {
+  status := LogValueMap["$Status"]
+  defer func() { LogValueMap["$Status"] = status }()
+  LogValueMap["$Status"] = func(*LogContext, time.Time, http.ResponseWriter, *http.Request) string {
+    return "custom" }
+
+  for _, encoding := range []string{TextEncoding, JSONEncoding} {
+    buf := &bytes.Buffer{}
+    l := NewHttpLogger(buf, "$Status $BodyBytes")
+    l.SetLogEncoding(encoding)
+    testLogRequest(l, 200, "hi")
+
+    if encoding == TextEncoding {
+      testAssertEqual(t, "custom 2\n", buf.String())
+    } else {
+      testAssertEqual(t, "{\"Status\":null,\"BodyBytes\":2}\n", buf.String())
+    }
+  }
+}
+
+
+func newTestLogRequest() (http.ResponseWriter, *http.Request) {
+  req := httptest.NewRequest("GET", "/path?q=1", nil)
+  req.RemoteAddr = "10.0.0.1:1234"
+  req.Header.Set("User-Agent", "test-agent")
+  req.Header.Set("Referer", "http://example.com/")
+
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  res.WriteHeader(200)
+  res.Write([]byte("hello"))
+  return res, req
+}
+
+
+func TestHttpLoggerAllocs(t *testing.T) {
+  if raceEnabled { t.Skip( "sync.Pool drops items with -race" ) }
+  l := NewHttpLogger(ioutil.Discard)
+  l.SetLogFormat(DefaultLogFormat + " $RequestTime $TimeUnix $Header[User-Agent]")
+  res, req := newTestLogRequest()
+  now := time.Now()
+
+  for _, encoding := range []string{TextEncoding, JSONEncoding, LogfmtEncoding} {
+    l.SetLogEncoding(encoding)
+    allocs := testing.AllocsPerRun(100, func() { l.Log(now, res, req) })
+    testAssertEqual(t, float64(0), allocs)
+  }
+}
+
+
+func BenchmarkHttpLoggerText(b *testing.B) {
+  l := NewHttpLogger(ioutil.Discard)
+  res, req := newTestLogRequest()
+  now := time.Now()
+
+  b.ReportAllocs()
+  for i := 0; i < b.N; i++ { l.Log(now, res, req) }
+}
+
+
+func BenchmarkHttpLoggerJSON(b *testing.B) {
+  l := NewHttpLogger(ioutil.Discard)
+  l.SetLogEncoding(JSONEncoding)
+  res, req := newTestLogRequest()
+  now := time.Now()
+
+  b.ReportAllocs()
+  for i := 0; i < b.N; i++ { l.Log(now, res, req) }
+}
+
+
+func BenchmarkHttpLoggerParallel(b *testing.B) {
+  l := NewHttpLogger(ioutil.Discard)
+  res, req := newTestLogRequest()
+  now := time.Now()
+
+  b.ReportAllocs()
+  b.RunParallel(func(pb *testing.PB) {
+    for pb.Next() { l.Log(now, res, req) }
+  })
+}
@@ -0,0 +1,185 @@
+package gosrv
+
+import (
+  "strconv"
+  "unicode/utf8"
+)
+
+
+// Log encodings for HttpLogger.SetLogEncoding.
+const (
+  TextEncoding   = "text"
+  JSONEncoding   = "json"
+  LogfmtEncoding = "logfmt"
+)
+
+
+// Appends a log line of the log fields and their values to buf.
+type logEncoder func(buf []byte, keys []string, values [][]byte) []byte
+
+
+var logEncoders = map[string]logEncoder {
+  JSONEncoding: encodeJSONLog,
+  LogfmtEncoding: encodeLogfmtLog,
+}
+
+
+// Writes a JSON object per line. Numeric fields are written as numbers,
+// or null when missing.
+func encodeJSONLog(buf []byte, keys []string, values [][]byte) []byte {
+  buf = append(buf, '{')
+
+  for i, k := range keys {
+    if i > 0 { buf = append(buf, ',') }
+    buf = appendJSONString(buf, []byte(k[1:]))
+    buf = append(buf, ':')
+
+    val := values[i]
+    if NumericLogValues[k] {
+      if isJSONNumber(val) {
+        buf = append(buf, val...)
+      } else {
+        buf = append(buf, "null"...)
+      }
+      continue
+    }
+
+    buf = appendJSONString(buf, val)
+  }
+
+  return append(buf, '}', '\n')
+}
+
+
+// Writes key=value pairs per line, quoting values as needed.
+func encodeLogfmtLog(buf []byte, keys []string, values [][]byte) []byte {
+  for i, k := range keys {
+    if i > 0 { buf = append(buf, ' ') }
+    buf = append(buf, k[1:]...)
+    buf = append(buf, '=')
+
+    if needsQuote(values[i]) {
+      buf = appendQuoted(buf, values[i])
+    } else {
+      buf = append(buf, values[i]...)
+    }
+  }
+
+  return append(buf, '\n')
+}
+
+
+// Reports whether a logfmt value has to be quoted.
+func needsQuote(val []byte) bool {
+  if len(val) == 0 || !utf8.Valid(val) { return true }
+  for _, c := range val {
+    if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f { return true }
+  }
+  return false
+}
+
+
+// Appends val quoted the way strconv.AppendQuote would, without converting
+// it to a string first.
+func appendQuoted(buf, val []byte) []byte {
+  buf = append(buf, '"')
+
+  for i := 0; i < len(val); {
+    r, size := utf8.DecodeRune(val[i:])
+    switch {
+    case r == utf8.RuneError && size == 1:
+      buf = append(buf, '\\', 'x', hexDigits[val[i]>>4], hexDigits[val[i]&0xf])
+    case r == '"' || r == '\\':
+      buf = append(buf, '\\', byte(r))
+    case strconv.IsPrint(r):
+      buf = append(buf, val[i:i+size]...)
+    default:
+      n := len(buf)
+      buf = strconv.AppendQuoteRune(buf, r)
+      buf = append(buf[:n], buf[n+1:len(buf)-1]...)
+    }
+    i += size
+  }
+
+  return append(buf, '"')
+}
+
+
+// Reports whether val is a number as JSON writes it, e.g. 12 or -0.5e3.
+func isJSONNumber(val []byte) bool {
+  i := 0
+  if i < len(val) && val[i] == '-' { i++ }
+
+  start := i
+  for i < len(val) && val[i] >= '0' && val[i] <= '9' { i++ }
+  if i == start || (val[start] == '0' && i - start > 1) { return false }
+
+  if i < len(val) && val[i] == '.' {
+    i++
+    start = i
+    for i < len(val) && val[i] >= '0' && val[i] <= '9' { i++ }
+    if i == start { return false }
+  }
+
+  if i < len(val) && (val[i] == 'e' || val[i] == 'E') {
+    i++
+    if i < len(val) && (val[i] == '+' || val[i] == '-') { i++ }
+    start = i
+    for i < len(val) && val[i] >= '0' && val[i] <= '9' { i++ }
+    if i == start { return false }
+  }
+
+  return i == len(val)
+}
+
+
+func needsEscape(s string) bool {
+  for i := 0; i < len(s); i++ {
+    if s[i] < 0x20 || s[i] == 0x7f { return true }
+  }
+  return !utf8.ValidString(s)
+}
+
+
+const hexDigits = "0123456789abcdef"
+
+func appendJSONString(buf, s []byte) []byte {
+  buf = append(buf, '"')
+
+  for i := 0; i < len(s); {
+    c := s[i]
+    if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf {
+      buf = append(buf, c)
+      i++
+      continue
+    }
+
+    switch c {
+    case '"', '\\':
+      buf = append(buf, '\\', c)
+    case '\n':
+      buf = append(buf, '\\', 'n')
+    case '\r':
+      buf = append(buf, '\\', 'r')
+    case '\t':
+      buf = append(buf, '\\', 't')
+    default:
+      if c < 0x20 {
+        buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+        break
+      }
+
+      r, size := utf8.DecodeRune(s[i:])
+      if r == utf8.RuneError && size == 1 {
+        buf = append(buf, "\ufffd"...)
+      } else {
+        buf = append(buf, s[i:i+size]...)
+      }
+      i += size
+      continue
+    }
+    i++
+  }
+
+  return append(buf, '"')
+}
@@ -0,0 +1,176 @@
+package gosrv
+
+import (
+  "fmt"
+  "regexp"
+  "strings"
+  "sync"
+)
+
+
+// Query parameters, headers and patterns redacted from access logs by
+// default.
+var DefaultRedactParams = []string{"token", "access_token", "refresh_token", "id_token",
+  "password", "passwd", "secret", "client_secret", "api_key", "apikey", "key", "signature"}
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie",
+  "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+var DefaultRedactPatterns = []string{}
+
+
+// Replaces sensitive data in access log values with [REDACTED]:
+//  * the value of query parameters with the given names, wherever a log
+//    value holds a query string, e.g. $RequestUri, $Request, $HttpReferer
+//  * $Header, $ResponseHeader, $Query and $Cookie values with the given names
+//  * any match of the given patterns in any log value
+// Names are case-insensitive.
+type LogRedactor struct {
+  params    map[string]bool
+  headers   map[string]bool
+  patterns  []*regexp.Regexp
+}
+
+
+// Creates a LogRedactor. Patterns are regular expressions.
+func NewLogRedactor(params, headers, patterns []string) (*LogRedactor, error) {
+  r := &LogRedactor{params: map[string]bool{}, headers: map[string]bool{}}
+
+  for _, p := range params { r.params[strings.ToLower(p)] = true }
+  for _, h := range headers { r.headers[strings.ToLower(h)] = true }
+
+  for _, p := range patterns {
+    re, err := regexp.Compile(p)
+    if err != nil { return nil, err }
+    r.patterns = append(r.patterns, re)
+  }
+
+  return r, nil
+}
+
+
+var defaultRedactor struct {
+  once  sync.Once
+  r     *LogRedactor
+  err   error
+}
+
+
+// Returns the LogRedactor of the default params, headers and patterns,
+// created on the first call and shared after. If a default pattern is
+// invalid it returns the error, along with a redactor of the default params
+// and headers only.
+func DefaultLogRedactor() (*LogRedactor, error) {
+  defaultRedactor.once.Do(func() {
+    r, err := NewLogRedactor(DefaultRedactParams, DefaultRedactHeaders, DefaultRedactPatterns)
+    if err != nil {
+      r, _ = NewLogRedactor(DefaultRedactParams, DefaultRedactHeaders, nil)
+      err = fmt.Errorf("invalid DefaultRedactPatterns: %v", err)
+    }
+    defaultRedactor.r, defaultRedactor.err = r, err
+  })
+  return defaultRedactor.r, defaultRedactor.err
+}
+
+
+// Returns true if the whole value of the given log keyword is redacted,
+// e.g. $Header[Authorization] or $Query[token].
+func (r *LogRedactor) redactsKey(key string) bool {
+  if r == nil { return false }
+
+  _, param, ok := parseLogKey(key)
+  if !ok || param == "" { return false }
+
+  name := strings.ToLower(param)
+  switch key[:strings.IndexByte(key, '[')] {
+  case "$Header", "$ResponseHeader":
+    return r.headers[name]
+  case "$Query", "$Cookie":
+    return r.params[name]
+  }
+  return false
+}
+
+
+// Returns the value with sensitive data redacted.
+func (r *LogRedactor) Redact(val string) string {
+  if r == nil { return val }
+
+  b, ok := r.redact([]byte(val))
+  if !ok { return val }
+  return string(b)
+}
+
+
+// Redacts the bytes of buf from start, only allocating if anything is
+// redacted.
+func (r *LogRedactor) redactFrom(buf []byte, start int) []byte {
+  if r == nil { return buf }
+
+  b, ok := r.redact(buf[start:])
+  if !ok { return buf }
+  return append(buf[:start], b...)
+}
+
+
+// Returns a redacted copy of the value and true, or false if there is
+// nothing to redact. The value is never modified.
+func (r *LogRedactor) redact(val []byte) ([]byte, bool) {
+  out, changed := val, false
+  if len(r.params) > 0 { out, changed = r.redactParams(val) }
+
+  for _, re := range r.patterns {
+    if !re.Match(out) { continue }
+
+    if !changed { out = append([]byte(nil), val...) }
+    out = re.ReplaceAllLiteral(out, []byte(RedactedValue))
+    changed = true
+  }
+
+  return out, changed
+}
+
+
+// Redacts the values of name=value pairs following ?, & or ; with a
+// redacted name.
+func (r *LogRedactor) redactParams(val []byte) ([]byte, bool) {
+  var out []byte
+  last := 0
+
+  for i := 0; i < len(val); i++ {
+    if val[i] != '=' { continue }
+
+    start := i
+    for start > 0 && !isQueryDelim(val[start-1]) { start-- }
+    if start == 0 || start == i || !r.redactsParam(val[start:i]) { continue }
+
+    end := i + 1
+    for end < len(val) && !isQueryDelim(val[end]) && !isQueryEnd(val[end]) { end++ }
+    if end == i + 1 { continue }
+
+    out = append(out, val[last:i+1]...)
+    out = append(out, RedactedValue...)
+    last, i = end, end - 1
+  }
+
+  if out == nil { return val, false }
+  return append(out, val[last:]...), true
+}
+
+
+func isQueryDelim(c byte) bool {
+  return c == '?' || c == '&' || c == ';'
+}
+
+
+func isQueryEnd(c byte) bool {
+  return c == ' ' || c == '"' || c == '#' || c == '\t' || c == '\n'
+}
+
+
+// Returns true if the param is redacted. Lowercase names are looked up
+// without allocating.
+func (r *LogRedactor) redactsParam(name []byte) bool {
+  for _, c := range name {
+    if c >= 'A' && c <= 'Z' { return r.params[strings.ToLower(string(name))] }
+  }
+  return r.params[string(name)]
+}
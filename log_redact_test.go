@@ -0,0 +1,85 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "net/http/httptest"
+  "sync"
+  "time"
+)
+
+
+func TestLogRedactorRedact(t *testing.T) {
+  r, err := NewLogRedactor([]string{"token", "Api_Key"}, nil, []string{`\d{4}-\d{4}-\d{4}-\d{4}`})
+  if err != nil { t.Fatal( err ) }
+
+  tests := [][2]string{
+    {"/path?q=1", "/path?q=1"},
+    {"/path?token=abc&q=1", "/path?token=[REDACTED]&q=1"},
+    {"/path?q=1&API_KEY=abc", "/path?q=1&API_KEY=[REDACTED]"},
+    {"GET /reset?token=abc HTTP/1.1", "GET /reset?token=[REDACTED] HTTP/1.1"},
+    {"/path?mytoken=abc&token=", "/path?mytoken=abc&token="},
+    {"token=abc", "token=abc"},
+    {"card 1234-5678-9012-3456", "card [REDACTED]"},
+    {"/pay?token=a&card=1234-5678-9012-3456", "/pay?token=[REDACTED]&card=[REDACTED]"},
+  }
+
+  for _, test := range tests {
+    testAssertEqual(t, test[1], r.Redact(test[0]))
+  }
+
+  var none *LogRedactor
+  testAssertEqual(t, "/path?token=abc", none.Redact("/path?token=abc"))
+
+  _, err = NewLogRedactor(nil, nil, []string{"("})
+  if err == nil { t.Fatal( "Expected invalid pattern error" ) }
+}
+
+
+func TestDefaultLogRedactor(t *testing.T) {
+  r1, err := DefaultLogRedactor()
+  if err != nil { t.Fatal( err ) }
+  r2, _ := DefaultLogRedactor()
+  testAssertEqual(t, r1, r2)
+
+  patterns := DefaultRedactPatterns
+  defer func() {
+    DefaultRedactPatterns = patterns
+    defaultRedactor.once = sync.Once{}
+  }()
+  DefaultRedactPatterns = []string{"("}
+  defaultRedactor.once = sync.Once{}
+
+  r, err := DefaultLogRedactor()
+  if err == nil { t.Fatal( "Expected invalid pattern error" ) }
+  testAssertEqual(t, "/?token=[REDACTED]", r.Redact("/?token=abc"))
+}
+
+
+func TestHttpLoggerRedaction(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewHttpLogger(buf, "\"$Request\" $Header[Authorization] $Query[password] $Header[X-Tenant] $HttpReferer")
+
+  req := httptest.NewRequest("GET", "/login?user=bob&password=hunter2", nil)
+  req.Header.Set("Authorization", "Bearer abc")
+  req.Header.Set("X-Tenant", "acme")
+  req.Header.Set("Referer", "https://example.com/?api_key=abc")
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+
+  l.Log(time.Now(), res, req)
+  testAssertEqual(t, "\"GET /login?user=bob&password=[REDACTED] HTTP/1.1\" [REDACTED] [REDACTED] acme " +
+    "https://example.com/?api_key=[REDACTED]\n", buf.String())
+
+  buf.Reset()
+  l.SetLogEncoding(JSONEncoding)
+  l.SetLogFields([]string{"RequestUri", "Header[Authorization]"})
+  l.Log(time.Now(), res, req)
+  testAssertEqual(t, "{\"RequestUri\":\"/login?user=bob&password=[REDACTED]\"," +
+    "\"Header[Authorization]\":\"[REDACTED]\"}\n", buf.String())
+
+  buf.Reset()
+  l.SetRedactor(nil)
+  l.Log(time.Now(), res, req)
+  testAssertEqual(t, "{\"RequestUri\":\"/login?user=bob&password=hunter2\"," +
+    "\"Header[Authorization]\":\"Bearer abc\"}\n", buf.String())
+}
@@ -0,0 +1,124 @@
+package gosrv
+
+import (
+  "fmt"
+  "math/rand"
+  "net/http"
+  "strconv"
+  "strings"
+  "time"
+)
+
+
+// Requests at least this slow are logged regardless of skip and sample rules.
+var DefaultLogSlowThreshold = time.Second
+
+
+// Matches requests for log skip and sample rules.
+type logSelector func(wr http.ResponseWriter, req *http.Request) bool
+
+
+// Returns a LogFilter dropping requests that match a skip rule, and keeping
+// requests that match a sample rule at the rule's rate. The first matching
+// sample rule applies. Error responses and requests taking at least
+// keep_slow are always kept.
+//
+// Rules select requests by:
+//  * /path     Path prefix
+//  * GET       Method
+//  * 2xx       Status class
+//  * ua:text   User agent containing text
+//  * *         All requests
+// Sample rules add a rate from 0 to 1, e.g. "2xx:0.1" or "/static:0.01".
+func NewSamplingFilter(skip, sample []string, keep_slow time.Duration) (LogFilter, error) {
+  skips := []logSelector{}
+  for _, rule := range skip {
+    sel, err := parseLogSelector(rule)
+    if err != nil { return nil, err }
+    skips = append(skips, sel)
+  }
+
+  samples := []logSelector{}
+  rates := []float64{}
+  for _, rule := range sample {
+    i := strings.LastIndex(rule, ":")
+    if i < 0 { return nil, fmt.Errorf("log sample rule %q has no rate", rule) }
+
+    rate, err := strconv.ParseFloat(rule[i+1:], 64)
+    if err != nil || rate < 0 || rate > 1 {
+      return nil, fmt.Errorf("log sample rule %q rate must be from 0 to 1", rule) }
+
+    sel, err := parseLogSelector(rule[:i])
+    if err != nil { return nil, err }
+
+    samples = append(samples, sel)
+    rates = append(rates, rate)
+  }
+
+  return func(t time.Time, wr http.ResponseWriter, req *http.Request) bool {
+    if res, ok := wr.(*Response); ok && res.Status >= 500 { return true }
+    if keep_slow > 0 && time.Since(t) >= keep_slow { return true }
+
+    for _, sel := range skips {
+      if sel(wr, req) { return false }
+    }
+
+    for i, sel := range samples {
+      if sel(wr, req) { return rand.Float64() < rates[i] }
+    }
+    return true
+  }, nil
+}
+
+
+func parseLogSelector(rule string) (logSelector, error) {
+  rule = strings.TrimSpace(rule)
+
+  switch {
+  case rule == "*":
+    return func(wr http.ResponseWriter, req *http.Request) bool { return true }, nil
+
+  case strings.HasPrefix(rule, "/"):
+    return func(wr http.ResponseWriter, req *http.Request) bool {
+      return strings.HasPrefix(req.URL.Path, rule)
+    }, nil
+
+  case strings.HasPrefix(rule, "ua:"):
+    text := rule[3:]
+    return func(wr http.ResponseWriter, req *http.Request) bool {
+      return strings.Contains(req.UserAgent(), text)
+    }, nil
+
+  case isStatusClass(rule):
+    class := int(rule[0] - '0')
+    return func(wr http.ResponseWriter, req *http.Request) bool {
+      res, ok := wr.(*Response)
+      return ok && res.Status / 100 == class
+    }, nil
+
+  case rule != "" && strings.ToUpper(rule) == rule && strings.Trim(rule, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "":
+    return func(wr http.ResponseWriter, req *http.Request) bool { return req.Method == rule }, nil
+  }
+
+  return nil, fmt.Errorf("invalid log rule %q", rule)
+}
+
+
+// Returns a LogFilter accepting requests all the given filters accept.
+// Nil filters are ignored, and nil is returned if all are nil.
+func AllLogFilters(filters ...LogFilter) LogFilter {
+  all := []LogFilter{}
+  for _, f := range filters {
+    if f != nil { all = append(all, f) }
+  }
+
+  if len(all) == 0 { return nil }
+  if len(all) == 1 { return all[0] }
+
+  return func(t time.Time, wr http.ResponseWriter, req *http.Request) bool {
+    for _, f := range all {
+      if !f(t, wr, req) { return false }
+    }
+    return true
+  }
+}
@@ -0,0 +1,57 @@
+package gosrv
+
+import (
+  "testing"
+  "net/http/httptest"
+  "time"
+)
+
+
+func TestSamplingFilterSkip(t *testing.T) {
+  f, err := NewSamplingFilter([]string{"/health", "OPTIONS", "3xx", "ua:kube-probe"}, nil, time.Second)
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, false, testFilterRequest(f, "GET", "/health", 200))
+  testAssertEqual(t, false, testFilterRequest(f, "GET", "/healthz", 200))
+  testAssertEqual(t, false, testFilterRequest(f, "OPTIONS", "/", 200))
+  testAssertEqual(t, false, testFilterRequest(f, "GET", "/", 302))
+  testAssertEqual(t, true, testFilterRequest(f, "GET", "/", 200))
+
+  // Errors are always kept.
+  testAssertEqual(t, true, testFilterRequest(f, "GET", "/health", 503))
+
+  req := httptest.NewRequest("GET", "/", nil)
+  req.Header.Set("User-Agent", "kube-probe/1.29")
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  res.WriteHeader(200)
+  testAssertEqual(t, false, f(time.Now(), res, req))
+
+  // Slow requests are always kept.
+  testAssertEqual(t, true, f(time.Now().Add(-2 * time.Second), res, req))
+}
+
+
+func TestSamplingFilterSample(t *testing.T) {
+  f, err := NewSamplingFilter(nil, []string{"/static:0", "2xx:0.5", "*:1"}, 0)
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, false, testFilterRequest(f, "GET", "/static/app.js", 200))
+  testAssertEqual(t, true, testFilterRequest(f, "GET", "/", 404))
+
+  kept := 0
+  for i := 0; i < 10000; i++ {
+    if testFilterRequest(f, "GET", "/", 200) { kept++ }
+  }
+  if kept < 4000 || kept > 6000 { t.Fatalf("Expected about 5000 sampled requests, got %d", kept) }
+}
+
+
+func TestSamplingFilterInvalid(t *testing.T) {
+  for _, rules := range [][]string{{"2xx"}, {"2xx:2"}, {"health:0.5"}, {"2xx:x"}} {
+    _, err := NewSamplingFilter(nil, rules, 0)
+    if err == nil { t.Fatalf("Expected error for %v", rules) }
+  }
+
+  _, err := NewSamplingFilter([]string{"health"}, nil, 0)
+  if err == nil { t.Fatal( "Expected invalid skip rule error" ) }
+}
@@ -0,0 +1,243 @@
+package gosrv
+
+import (
+  "fmt"
+  "io"
+  "net/http"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+
+// Decides whether a request is written to a log sink.
+type LogFilter func(t time.Time, wr http.ResponseWriter, req *http.Request) bool
+
+
+// Name of the sink of the top-level log config keys.
+const DefaultLogSink = "default"
+
+
+// A named HttpLogger with an optional filter.
+type LogSink struct {
+  Name    string
+  Logger  HttpLogger
+  Filter  LogFilter
+}
+
+
+// An HttpLogger writing requests to several sinks, each with its own format,
+// encoding, writer and filter. Setters apply to every sink; configure
+// individual sinks through their own Logger.
+type MultiLogger struct {
+  sinks  []*LogSink
+  mutex  sync.RWMutex
+}
+
+
+func NewMultiLogger(sinks ...*LogSink) *MultiLogger {
+  return &MultiLogger{sinks: sinks}
+}
+
+
+// Adds a sink logging the requests the filter accepts, or all requests if
+// the filter is nil.
+func (m *MultiLogger) AddSink(name string, logger HttpLogger, filter LogFilter) {
+  m.mutex.Lock()
+  m.sinks = append(m.sinks, &LogSink{name, logger, filter})
+  m.mutex.Unlock()
+}
+
+
+// Returns the sink with the given name, or nil.
+func (m *MultiLogger) Sink(name string) *LogSink {
+  m.mutex.RLock()
+  defer m.mutex.RUnlock()
+
+  for _, sink := range m.sinks {
+    if sink.Name == name { return sink }
+  }
+  return nil
+}
+
+
+// Returns all sinks.
+func (m *MultiLogger) Sinks() []*LogSink {
+  m.mutex.RLock()
+  defer m.mutex.RUnlock()
+  return append([]*LogSink{}, m.sinks...)
+}
+
+
+func (m *MultiLogger) SetLogFormat(format string) {
+  for _, sink := range m.Sinks() { sink.Logger.SetLogFormat(format) }
+}
+
+
+func (m *MultiLogger) SetTimeFormat(time_format string) {
+  for _, sink := range m.Sinks() { sink.Logger.SetTimeFormat(time_format) }
+}
+
+
+func (m *MultiLogger) SetLogEncoding(encoding string) error {
+  for _, sink := range m.Sinks() {
+    err := sink.Logger.SetLogEncoding(encoding)
+    if err != nil { return err }
+  }
+  return nil
+}
+
+
+func (m *MultiLogger) SetLogFields(fields []string) error {
+  for _, sink := range m.Sinks() {
+    err := sink.Logger.SetLogFields(fields)
+    if err != nil { return err }
+  }
+  return nil
+}
+
+
+func (m *MultiLogger) SetRedactor(r *LogRedactor) {
+  for _, sink := range m.Sinks() { sink.Logger.SetRedactor(r) }
+}
+
+
+func (m *MultiLogger) SetWriter(wr io.Writer) {
+  for _, sink := range m.Sinks() { sink.Logger.SetWriter(wr) }
+}
+
+
+func (m *MultiLogger) Write(bytes []byte) (int, error) {
+  for _, sink := range m.Sinks() {
+    _, err := sink.Logger.Write(bytes)
+    if err != nil { return 0, err }
+  }
+  return len(bytes), nil
+}
+
+
+func (m *MultiLogger) Printf(format string, i ...interface{}) (int, error) {
+  return fmt.Fprintf(m, format, i...)
+}
+
+
+func (m *MultiLogger) Println(i ...interface{}) (int, error) {
+  return fmt.Fprintln(m, i...)
+}
+
+
+func (m *MultiLogger) Log(t time.Time, wr http.ResponseWriter, req *http.Request) {
+  m.mutex.RLock()
+  sinks := m.sinks
+  m.mutex.RUnlock()
+
+  for _, sink := range sinks {
+    if sink.Filter == nil || sink.Filter(t, wr, req) { sink.Logger.Log(t, wr, req) }
+  }
+}
+
+
+// Parses a filter of comma-separated conditions which must all match, e.g.
+// "path!=/health, status>=500". Conditions compare a field to a value with
+// =, !=, ^= (starts with), <, <=, > or >=. Fields are:
+//  * path      The request path
+//  * method    The request method
+//  * status    The response status, may be a class such as 5xx
+//  * host      The request host
+func ParseLogFilter(expr string) (LogFilter, error) {
+  conds := []LogFilter{}
+
+  for _, part := range strings.Split(expr, ",") {
+    part = strings.TrimSpace(part)
+    if part == "" { continue }
+
+    cond, err := parseLogCondition(part)
+    if err != nil { return nil, err }
+    conds = append(conds, cond)
+  }
+
+  return func(t time.Time, wr http.ResponseWriter, req *http.Request) bool {
+    for _, cond := range conds {
+      if !cond(t, wr, req) { return false }
+    }
+    return true
+  }, nil
+}
+
+
+var logFilterOps = []string{"!=", "^=", "<=", ">=", "=", "<", ">"}
+
+var logFilterFields = map[string]func(http.ResponseWriter, *http.Request) string {
+  "path": func(wr http.ResponseWriter, req *http.Request) string { return req.URL.Path },
+  "method": func(wr http.ResponseWriter, req *http.Request) string { return req.Method },
+  "host": func(wr http.ResponseWriter, req *http.Request) string { return req.Host },
+  "status": func(wr http.ResponseWriter, req *http.Request) string {
+    if res, ok := wr.(*Response); ok { return strconv.Itoa(res.Status) }
+    return ""
+  },
+}
+
+
+func parseLogCondition(cond string) (LogFilter, error) {
+  for i := 0; i < len(cond); i++ {
+    op := ""
+    for _, o := range logFilterOps {
+      if strings.HasPrefix(cond[i:], o) { op = o; break }
+    }
+    if op == "" { continue }
+
+    name := strings.TrimSpace(cond[:i])
+    value := strings.TrimSpace(cond[i+len(op):])
+
+    field, ok := logFilterFields[name]
+    if !ok { return nil, fmt.Errorf("unknown log filter field %q", name) }
+
+    match, err := logFilterMatch(op, value)
+    if err != nil { return nil, err }
+
+    return func(t time.Time, wr http.ResponseWriter, req *http.Request) bool {
+      return match(field(wr, req))
+    }, nil
+  }
+
+  return nil, fmt.Errorf("invalid log filter condition %q", cond)
+}
+
+
+func logFilterMatch(op, value string) (func(string) bool, error) {
+  switch op {
+  case "=", "!=":
+    eq := func(v string) bool { return v == value }
+    if isStatusClass(value) {
+      eq = func(v string) bool { return len(v) == 3 && v[0] == value[0] }
+    }
+    if op == "!=" { return func(v string) bool { return !eq(v) }, nil }
+    return eq, nil
+
+  case "^=":
+    return func(v string) bool { return strings.HasPrefix(v, value) }, nil
+  }
+
+  n, err := strconv.Atoi(value)
+  if err != nil { return nil, fmt.Errorf("%q is not a number", value) }
+
+  return func(v string) bool {
+    i, err := strconv.Atoi(v)
+    if err != nil { return false }
+
+    switch op {
+    case "<": return i < n
+    case "<=": return i <= n
+    case ">": return i > n
+    }
+    return i >= n
+  }, nil
+}
+
+
+// Returns true for status classes such as 2xx.
+func isStatusClass(value string) bool {
+  return len(value) == 3 && value[0] >= '1' && value[0] <= '5' &&
+    strings.ToLower(value[1:]) == "xx"
+}
@@ -0,0 +1,74 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "net/http/httptest"
+  "time"
+)
+
+
+func testFilterRequest(f LogFilter, method, path string, status int) bool {
+  req := httptest.NewRequest(method, path, nil)
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  res.WriteHeader(status)
+  return f(time.Now(), res, req)
+}
+
+
+func TestMultiLogger(t *testing.T) {
+  text, json := &bytes.Buffer{}, &bytes.Buffer{}
+
+  errors, err := ParseLogFilter("status>=500")
+  if err != nil { t.Fatal( err ) }
+
+  m := NewMultiLogger()
+  m.AddSink("text", NewHttpLogger(text, "$Status $RequestPath"), nil)
+  m.AddSink("errors", NewHttpLogger(json, "$Status $RequestPath"), errors)
+  m.Sink("errors").Logger.SetLogEncoding(JSONEncoding)
+
+  testLogRequest(m, 200, "")
+  testLogRequest(m, 503, "")
+
+  testAssertEqual(t, "200 /path\n503 /path\n", text.String())
+  testAssertEqual(t, "{\"Status\":503,\"RequestPath\":\"/path\"}\n", json.String())
+  testAssertEqual(t, true, m.Sink("missing") == nil)
+
+  m.SetLogFormat("$Status")
+  testLogRequest(m, 200, "")
+  testAssertEqual(t, "200 /path\n503 /path\n200\n", text.String())
+}
+
+
+func TestParseLogFilter(t *testing.T) {
+  tests := []struct {
+    expr, method, path string
+    status int
+    expected bool
+  }{
+    {"path!=/health", "GET", "/health", 200, false},
+    {"path!=/health", "GET", "/", 200, true},
+    {"path^=/api/", "GET", "/api/users", 200, true},
+    {"status>=500", "GET", "/", 404, false},
+    {"status=4xx", "GET", "/", 404, true},
+    {"status!=2xx, method=POST", "POST", "/", 302, true},
+    {"status!=2xx, method=POST", "GET", "/", 302, false},
+    {"status<300", "GET", "/", 200, true},
+    {"path=/a=b", "GET", "/a=b", 200, true},
+    {"", "GET", "/", 200, true},
+  }
+
+  for _, test := range tests {
+    f, err := ParseLogFilter(test.expr)
+    if err != nil { t.Fatal( err ) }
+    if testFilterRequest(f, test.method, test.path, test.status) != test.expected {
+      t.Errorf("Expected %q to be %v for %s %s %d", test.expr, test.expected,
+        test.method, test.path, test.status)
+    }
+  }
+
+  for _, expr := range []string{"size>1", "status>=abc", "path"} {
+    _, err := ParseLogFilter(expr)
+    if err == nil { t.Errorf("Expected error for filter %q", expr) }
+  }
+}
@@ -1,10 +1,14 @@
 package gosrv
 
 import (
+  "net"
   "net/http"
   "time"
   "os"
+  "log/slog"
+  "sort"
   "sync"
+  "sync/atomic"
 )
 
 
@@ -12,25 +16,93 @@ import (
 type Mux struct {
   *http.ServeMux
   Logger    HttpLogger
+  Events    *EventLogger
   conns     *sync.WaitGroup
   stopped   bool
   rwlock    sync.RWMutex
+  routes    []string
+  active    int64
+  slog      *slog.Logger
+  requestId   func() string
+  trustedIds  []*net.IPNet
+  slowThreshold  time.Duration
+  slowStacks     bool
 }
 
 
 func NewMux() *Mux {
-  return &Mux{http.NewServeMux(), NewHttpLogger(os.Stdout),
-    &sync.WaitGroup{}, false, sync.RWMutex{}}
+  return &Mux{ServeMux: http.NewServeMux(), Logger: NewHttpLogger(os.Stdout),
+    Events: NewEventLogger(os.Stderr), conns: &sync.WaitGroup{},
+    requestId: RequestIdFormats[DefaultRequestIdFormat]}
+}
+
+
+// Registers the handler for the given pattern, see http.ServeMux.
+func (m *Mux) Handle(pattern string, handler http.Handler) {
+  m.ServeMux.Handle(pattern, handler)
+
+  m.rwlock.Lock()
+  m.routes = append(m.routes, pattern)
+  m.rwlock.Unlock()
+}
+
+
+// Registers the handler function for the given pattern, see http.ServeMux.
+func (m *Mux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+  m.Handle(pattern, http.HandlerFunc(handler))
+}
+
+
+// Returns the patterns of all registered handlers, sorted.
+func (m *Mux) Routes() []string {
+  m.rwlock.RLock()
+  routes := append([]string{}, m.routes...)
+  m.rwlock.RUnlock()
+
+  sort.Strings(routes)
+  return routes
+}
+
+
+// Returns the number of requests being served.
+func (m *Mux) ActiveRequests() int {
+  return int(atomic.LoadInt64(&m.active))
 }
 
 
 func (m *Mux) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
   m.conns.Add(1)
+  defer m.conns.Done()
+  atomic.AddInt64(&m.active, 1)
+  defer atomic.AddInt64(&m.active, -1)
   res := NewResponse(wr, m)
 
   stime := time.Now()
+
+  m.rwlock.RLock()
+  logger, slogger, events := m.Logger, m.slog, m.Events
+  gen, trusted := m.requestId, m.trustedIds
+  threshold, stacks := m.slowThreshold, m.slowStacks
+  m.rwlock.RUnlock()
+
+  id := requestIdFor(req, gen, trusted)
+  res.Header().Set(RequestIdHeader, id)
+
+  res.connId, res.connRequest = nextConnRequest(req.Context())
+  if req.Body != nil && req.Body != http.NoBody {
+    res.requestBody = &countingBody{ReadCloser: req.Body}
+    req.Body = res.requestBody
+  }
+
+  ctx := WithRequestId(req.Context(), id)
+  if slogger != nil { ctx = withSlogLogger(ctx, slogger) }
+  req = req.WithContext(ctx)
+
+  if threshold > 0 && events != nil {
+    slow := watchSlowRequest(events, stime, req, threshold, stacks)
+    defer slow.Stop()
+  }
+
   m.ServeMux.ServeHTTP(res, req)
-  m.Logger.Log(stime, res, req)
-  
-  if m.conns != nil { m.conns.Done() }
+  logger.Log(stime, res, req)
 }
\ No newline at end of file
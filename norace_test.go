@@ -0,0 +1,6 @@
+//go:build !race
+
+package gosrv
+
+
+const raceEnabled = false
@@ -0,0 +1,8 @@
+//go:build race
+
+package gosrv
+
+
+// The race detector makes sync.Pool drop items, so pooled buffers
+// allocate now and then.
+const raceEnabled = true
@@ -0,0 +1,221 @@
+package gosrv
+
+import (
+  "context"
+  "crypto/rand"
+  "encoding/binary"
+  "encoding/hex"
+  "fmt"
+  "net"
+  "net/http"
+  "strconv"
+  "strings"
+  "time"
+)
+
+
+// Header carrying request IDs, in both requests and responses.
+var RequestIdHeader = "X-Request-Id"
+
+// Request ID format used by a new Mux.
+var DefaultRequestIdFormat = "uuid4"
+
+// Incoming request IDs longer than this are replaced.
+const maxRequestIdLength = 128
+
+
+// Map of request ID formats to generators. More may be added at need.
+//  * uuid4   Random UUID, e.g. 0b5e3a56-1c1e-4e4f-9d2e-2c8f0e6f3b1a
+//  * ulid    Lexicographically sortable ULID, e.g. 01HF8Z6Q7X3K9V2M4N5P6R7S8T
+//  * ksuid   K-sortable KSUID, e.g. 2Y9ZvbBKzHx0HXlxJ1VjJ5pHb3q
+var RequestIdFormats = map[string]func() string {
+  "uuid4": NewUUID4,
+  "ulid": NewULID,
+  "ksuid": NewKSUID,
+}
+
+
+type requestIdKey struct{}
+
+
+// Returns the ID the Mux assigned to the given request, or "".
+func RequestId(req *http.Request) string {
+  id, _ := req.Context().Value(requestIdKey{}).(string)
+  return id
+}
+
+
+// Returns a context holding the given request ID.
+func WithRequestId(ctx context.Context, id string) context.Context {
+  return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+
+// Sets the format of the request IDs the Mux generates, see
+// RequestIdFormats.
+func (m *Mux) SetRequestIdFormat(format string) error {
+  gen, ok := RequestIdFormats[format]
+  if !ok { return mkerr("Unknown request ID format %q.", format) }
+
+  m.rwlock.Lock()
+  m.requestId = gen
+  m.rwlock.Unlock()
+  return nil
+}
+
+
+// Accepts the incoming request ID header of requests from the given IPs
+// or CIDR ranges, such as a load balancer, instead of generating an ID.
+// "*" trusts every client. Request IDs are never trusted by default.
+func (m *Mux) TrustRequestIds(sources ...string) error {
+  trusted, err := parseIPNets(sources)
+  if err != nil { return mkerr("Invalid trusted request ID source: %v.", err) }
+
+  m.rwlock.Lock()
+  m.trustedIds = trusted
+  m.rwlock.Unlock()
+  return nil
+}
+
+
+// Parses IPs and CIDR ranges, where "*" matches all IPs.
+func parseIPNets(sources []string) ([]*net.IPNet, error) {
+  nets := []*net.IPNet{}
+
+  for _, src := range sources {
+    src = strings.TrimSpace(src)
+    if src == "*" {
+      nets = append(nets, &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+        &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)})
+      continue
+    }
+
+    if !strings.Contains(src, "/") {
+      ip := net.ParseIP(src)
+      if ip == nil { return nil, fmt.Errorf("%q is not an IP or CIDR", src) }
+      bits := 128
+      if ip.To4() != nil { bits = 32 }
+      src += "/" + strconv.Itoa(bits)
+    }
+
+    _, ipnet, err := net.ParseCIDR(src)
+    if err != nil { return nil, fmt.Errorf("%q is not an IP or CIDR", src) }
+    nets = append(nets, ipnet)
+  }
+
+  return nets, nil
+}
+
+
+// Returns the incoming ID of a request from a trusted source, or a new one.
+func requestIdFor(req *http.Request, gen func() string, trusted []*net.IPNet) string {
+  id := req.Header.Get(RequestIdHeader)
+  if id != "" && len(trusted) > 0 && validRequestId(id) {
+    host, _, err := net.SplitHostPort(req.RemoteAddr)
+    if err != nil { host = req.RemoteAddr }
+
+    if ip := net.ParseIP(host); ip != nil {
+      for _, ipnet := range trusted {
+        if ipnet.Contains(ip) { return id }
+      }
+    }
+  }
+
+  if gen == nil { gen = NewUUID4 }
+  return gen()
+}
+
+
+// Returns true for IDs of printable ASCII characters, so they can't break
+// log lines or headers.
+func validRequestId(id string) bool {
+  if len(id) > maxRequestIdLength { return false }
+
+  for i := 0; i < len(id); i++ {
+    if id[i] <= ' ' || id[i] > '~' || id[i] == '"' { return false }
+  }
+  return true
+}
+
+
+// Returns a random RFC 4122 version 4 UUID.
+func NewUUID4() string {
+  var b [16]byte
+  rand.Read(b[:])
+  b[6] = b[6] & 0x0f | 0x40
+  b[8] = b[8] & 0x3f | 0x80
+
+  var buf [36]byte
+  hex.Encode(buf[0:8], b[0:4])
+  buf[8] = '-'
+  hex.Encode(buf[9:13], b[4:6])
+  buf[13] = '-'
+  hex.Encode(buf[14:18], b[6:8])
+  buf[18] = '-'
+  hex.Encode(buf[19:23], b[8:10])
+  buf[23] = '-'
+  hex.Encode(buf[24:], b[10:])
+  return string(buf[:])
+}
+
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Returns a ULID: a 48 bit millisecond timestamp and 80 random bits,
+// encoded as 26 Crockford base32 characters.
+func NewULID() string {
+  return newULID(time.Now())
+}
+
+
+func newULID(t time.Time) string {
+  var b [16]byte
+  binary.BigEndian.PutUint64(b[:8], uint64(t.UnixMilli()) << 16)
+  rand.Read(b[6:])
+
+  hi := binary.BigEndian.Uint64(b[:8])
+  lo := binary.BigEndian.Uint64(b[8:])
+
+  var buf [26]byte
+  for i := 25; i >= 0; i-- {
+    buf[i] = crockfordBase32[lo & 31]
+    lo = lo >> 5 | hi << 59
+    hi >>= 5
+  }
+  return string(buf[:])
+}
+
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// KSUID timestamps count seconds from 2014-05-13.
+const ksuidEpoch = 1400000000
+
+// Returns a KSUID: a 32 bit second timestamp and 128 random bits, encoded
+// as 27 base62 characters.
+func NewKSUID() string {
+  return newKSUID(time.Now())
+}
+
+
+func newKSUID(t time.Time) string {
+  var b [20]byte
+  binary.BigEndian.PutUint32(b[:4], uint32(t.Unix() - ksuidEpoch))
+  rand.Read(b[4:])
+
+  // Divide the 160 bit number by 62 repeatedly, 32 bits at a time.
+  parts := [5]uint32{}
+  for i := range parts { parts[i] = binary.BigEndian.Uint32(b[i*4:]) }
+
+  var buf [27]byte
+  for i := 26; i >= 0; i-- {
+    rem := uint64(0)
+    for j := range parts {
+      n := rem << 32 | uint64(parts[j])
+      parts[j] = uint32(n / 62)
+      rem = n % 62
+    }
+    buf[i] = base62[rem]
+  }
+  return string(buf[:])
+}
@@ -0,0 +1,113 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "net/http"
+  "net/http/httptest"
+  "regexp"
+  "time"
+)
+
+
+var testUUID4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+
+func testRequestIdMux() *Mux {
+  m := NewMux()
+  m.Logger = NewHttpLogger(&bytes.Buffer{})
+  m.HandleFunc("/id", func(wr http.ResponseWriter, req *http.Request) {
+    wr.Write([]byte(RequestId(req)))
+  })
+  return m
+}
+
+
+func testRequestId(m *Mux, remote, incoming string) (string, string) {
+  req := httptest.NewRequest("GET", "/id", nil)
+  req.RemoteAddr = remote
+  if incoming != "" { req.Header.Set("X-Request-Id", incoming) }
+
+  rec := httptest.NewRecorder()
+  m.ServeHTTP(rec, req)
+  return rec.Body.String(), rec.Header().Get("X-Request-Id")
+}
+
+
+func TestMuxRequestId(t *testing.T) {
+  m := testRequestIdMux()
+  buf := &bytes.Buffer{}
+  m.Logger = NewHttpLogger(buf, "$RequestId")
+
+  id, header := testRequestId(m, "10.0.0.1:1234", "abc123")
+  testAssertEqual(t, true, testUUID4.MatchString(id))
+  testAssertEqual(t, id, header)
+  testAssertEqual(t, id + "\n", buf.String())
+
+  other, _ := testRequestId(m, "10.0.0.1:1234", "")
+  testAssertEqual(t, false, id == other)
+}
+
+
+func TestMuxTrustRequestIds(t *testing.T) {
+  m := testRequestIdMux()
+
+  err := m.TrustRequestIds("10.0.0.0/8", "::1")
+  if err != nil { t.Fatal( err ) }
+
+  id, header := testRequestId(m, "10.1.2.3:1234", "abc123")
+  testAssertEqual(t, "abc123", id)
+  testAssertEqual(t, "abc123", header)
+
+  id, _ = testRequestId(m, "[::1]:1234", "abc123")
+  testAssertEqual(t, "abc123", id)
+
+  id, _ = testRequestId(m, "192.168.0.1:1234", "abc123")
+  testAssertEqual(t, true, testUUID4.MatchString(id))
+
+  id, _ = testRequestId(m, "10.1.2.3:1234", "bad\"id")
+  testAssertEqual(t, true, testUUID4.MatchString(id))
+
+  err = m.TrustRequestIds("*")
+  if err != nil { t.Fatal( err ) }
+  id, _ = testRequestId(m, "192.168.0.1:1234", "abc123")
+  testAssertEqual(t, "abc123", id)
+
+  err = m.TrustRequestIds("10.0.0.0/33")
+  if err == nil { t.Fatal( "Expected invalid source error" ) }
+}
+
+
+func TestRequestIdFormats(t *testing.T) {
+  formats := map[string]*regexp.Regexp{
+    "uuid4": testUUID4,
+    "ulid": regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+    "ksuid": regexp.MustCompile(`^[0-9A-Za-z]{27}$`),
+  }
+
+  for format, re := range formats {
+    m := testRequestIdMux()
+    err := m.SetRequestIdFormat(format)
+    if err != nil { t.Fatal( err ) }
+
+    id, _ := testRequestId(m, "10.0.0.1:1234", "")
+    if !re.MatchString(id) { t.Fatalf("Invalid %s request ID %q", format, id) }
+  }
+
+  err := NewMux().SetRequestIdFormat("uuid1")
+  if err == nil { t.Fatal( "Expected unknown format error" ) }
+}
+
+
+func TestRequestIdSortable(t *testing.T) {
+  t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+  t2 := t1.Add(time.Second)
+
+  for i := 0; i < 100; i++ {
+    testAssertEqual(t, true, newULID(t1) < newULID(t2))
+    testAssertEqual(t, true, newKSUID(t1) < newKSUID(t2))
+  }
+
+  testAssertEqual(t, "01HK153X00", newULID(t1)[:10])
+  testAssertEqual(t, "2aKVL", newKSUID(t1)[:5])
+}
@@ -3,19 +3,25 @@ package gosrv
 import (
   "net/http"
   "strconv"
+  "time"
 )
 
 
 type Response struct {
   http.ResponseWriter
-  Status  int
-  written int
-  mux     *Mux
+  Status       int
+  written      int
+  mux          *Mux
+  headerTime   time.Time
+  headerBytes  int
+  requestBody  *countingBody
+  connId       uint64
+  connRequest  int64
 }
 
 
 func NewResponse(wr http.ResponseWriter, mux *Mux) *Response {
-  return &Response{wr, 200, 0, mux}
+  return &Response{ResponseWriter: wr, Status: 200, mux: mux}
 }
 
 // Returns true when the server is attempting to gracefully shut down and is
@@ -38,7 +44,15 @@ func (r Response) ContentLength() int {
 }
 
 
+// Returns when the response headers were written, or the zero time if they
+// haven't been yet.
+func (r Response) HeaderTime() time.Time {
+  return r.headerTime
+}
+
+
 func (r *Response) Write(body []byte) (int, error) {
+  if r.headerTime.IsZero() { r.wroteHeader(http.StatusOK) }
   num, err := r.ResponseWriter.Write(body)
   r.written += num
   return num, err
@@ -47,5 +61,29 @@ func (r *Response) Write(body []byte) (int, error) {
 
 func (r *Response) WriteHeader(status int) {
   r.Status = status
+  if r.headerTime.IsZero() { r.wroteHeader(status) }
   r.ResponseWriter.WriteHeader(status)
 }
+
+
+// Returns the approximate size of the response headers: the status line
+// and the headers set by the handler.
+func (r Response) HeaderBytes() int {
+  if r.headerBytes > 0 { return r.headerBytes }
+  return r.headerSize(r.Status)
+}
+
+
+func (r *Response) wroteHeader(status int) {
+  r.headerTime = time.Now()
+  r.headerBytes = r.headerSize(status)
+}
+
+
+func (r Response) headerSize(status int) int {
+  size := len("HTTP/1.1 000 \r\n\r\n") + len(http.StatusText(status))
+  for k, vals := range r.Header() {
+    for _, v := range vals { size += len(k) + len(v) + 4 }
+  }
+  return size
+}
@@ -0,0 +1,222 @@
+package gosrv
+
+import (
+  "compress/gzip"
+  "io"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "sync"
+  "time"
+)
+
+
+// Time format of rotated log file names, e.g. server-2006-01-02T15-04-05.000.log.
+const rotateTimeFormat = "2006-01-02T15-04-05.000"
+
+
+// A log file writer that rotates the file once it reaches MaxSize bytes
+// or, with Daily, when the day changes. Rotated files are renamed with a
+// timestamp and optionally gzipped. Safe for concurrent use.
+type RotatingFile struct {
+  Path        string
+  MaxSize     int64          // Rotate above this size in bytes, 0 for no limit
+  MaxAge      time.Duration  // Remove backups older than this, 0 to keep all
+  MaxBackups  int            // Number of backups to keep, 0 to keep all
+  Compress    bool           // Gzip backups
+  Daily       bool           // Rotate when the day changes
+
+  file        *os.File
+  size        int64
+  day         int
+  mutex       sync.Mutex
+  millMutex   sync.Mutex
+}
+
+
+// Opens the given log file for appending, creating it if needed.
+func OpenRotatingFile(path string) (*RotatingFile, error) {
+  r := &RotatingFile{Path: path}
+  err := r.open()
+  if err != nil { return nil, err }
+  return r, nil
+}
+
+
+// Writes to the log file, rotating it first as needed.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  if r.file == nil {
+    err := r.open()
+    if err != nil { return 0, err }
+  }
+
+  if r.MaxSize > 0 && r.size > 0 && r.size + int64(len(p)) > r.MaxSize ||
+    r.Daily && dayOf(time.Now()) != r.day {
+    err := r.rotate()
+    if err != nil { return 0, err }
+  }
+
+  n, err := r.file.Write(p)
+  r.size += int64(n)
+  return n, err
+}
+
+
+// Closes and reopens the log file, e.g. after it was moved by logrotate.
+func (r *RotatingFile) Reopen() error {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  r.close()
+  return r.open()
+}
+
+
+// Rotates the log file now.
+func (r *RotatingFile) Rotate() error {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  return r.rotate()
+}
+
+
+func (r *RotatingFile) Close() error {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  return r.close()
+}
+
+
+func (r *RotatingFile) open() error {
+  f, err := os.OpenFile(r.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
+  if err != nil { return err }
+
+  info, err := f.Stat()
+  if err != nil { f.Close(); return err }
+
+  r.file = f
+  r.size = info.Size()
+  r.day = dayOf(info.ModTime())
+  if r.size == 0 { r.day = dayOf(time.Now()) }
+  return nil
+}
+
+
+func (r *RotatingFile) close() error {
+  if r.file == nil { return nil }
+  err := r.file.Close()
+  r.file = nil
+  return err
+}
+
+
+func (r *RotatingFile) rotate() error {
+  r.close()
+
+  // Bump the timestamp rather than overwrite a backup rotated the same
+  // millisecond.
+  t := time.Now()
+  for {
+    if _, err := os.Lstat(r.backupName(t)); os.IsNotExist(err) { break }
+    t = t.Add(time.Millisecond)
+  }
+
+  err := os.Rename(r.Path, r.backupName(t))
+  if err != nil && !os.IsNotExist(err) { return err }
+
+  err = r.open()
+  if err != nil { return err }
+
+  go r.mill()
+  return nil
+}
+
+
+func (r *RotatingFile) backupName(t time.Time) string {
+  ext := filepath.Ext(r.Path)
+  return strings.TrimSuffix(r.Path, ext) + "-" + t.Format(rotateTimeFormat) + ext
+}
+
+
+// Compresses and removes old backups.
+func (r *RotatingFile) mill() {
+  r.millMutex.Lock()
+  defer r.millMutex.Unlock()
+
+  backups := r.backups()
+
+  if r.Compress {
+    for i, b := range backups {
+      if strings.HasSuffix(b, ".gz") { continue }
+      if gzipFile(b) == nil { backups[i] = b + ".gz" }
+    }
+  }
+
+  for i, b := range backups {
+    remove := r.MaxBackups > 0 && i >= r.MaxBackups
+    if !remove && r.MaxAge > 0 {
+      t, ok := r.backupTime(b)
+      remove = ok && time.Since(t) > r.MaxAge
+    }
+    if remove { os.Remove(b) }
+  }
+}
+
+
+// Returns the backup files of the log file, newest first.
+func (r *RotatingFile) backups() []string {
+  ext := filepath.Ext(r.Path)
+  matches, _ := filepath.Glob(strings.TrimSuffix(r.Path, ext) + "-*" + ext + "*")
+
+  backups := []string{}
+  for _, m := range matches {
+    if _, ok := r.backupTime(m); ok { backups = append(backups, m) }
+  }
+
+  sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+  return backups
+}
+
+
+// Returns the rotation time of a backup file from its name.
+func (r *RotatingFile) backupTime(name string) (time.Time, bool) {
+  ext := filepath.Ext(r.Path)
+  stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+  stamp = strings.TrimPrefix(stamp, strings.TrimSuffix(r.Path, ext) + "-")
+
+  t, err := time.ParseInLocation(rotateTimeFormat, stamp, time.Local)
+  return t, err == nil
+}
+
+
+func gzipFile(name string) error {
+  src, err := os.Open(name)
+  if err != nil { return err }
+  defer src.Close()
+
+  dst, err := os.OpenFile(name + ".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0660)
+  if err != nil { return err }
+
+  gz := gzip.NewWriter(dst)
+  _, err = io.Copy(gz, src)
+  if err == nil { err = gz.Close() }
+  if err == nil { err = dst.Close() } else { dst.Close() }
+
+  if err != nil {
+    os.Remove(name + ".gz")
+    return err
+  }
+  return os.Remove(name)
+}
+
+
+func dayOf(t time.Time) int {
+  y, m, d := t.Date()
+  return y * 10000 + int(m) * 100 + d
+}
@@ -0,0 +1,144 @@
+package gosrv
+
+import (
+  "testing"
+  "compress/gzip"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sync"
+  "time"
+)
+
+
+func testRotateDir(t *testing.T) string {
+  dir, err := ioutil.TempDir("", "gosrv-rotate")
+  if err != nil { t.Fatal( err ) }
+  return dir
+}
+
+
+func TestRotatingFileMaxSize(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  r, err := OpenRotatingFile(filepath.Join(dir, "server.log"))
+  if err != nil { t.Fatal( err ) }
+  defer r.Close()
+  r.MaxSize = 10
+
+  r.Write([]byte("123456\n"))
+  r.Write([]byte("abcdef\n"))
+  r.mill()
+
+  backups := r.backups()
+  testAssertEqual(t, 1, len(backups))
+
+  data, err := ioutil.ReadFile(backups[0])
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "123456\n", string(data))
+
+  data, err = ioutil.ReadFile(r.Path)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "abcdef\n", string(data))
+}
+
+
+func TestRotatingFileBackups(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  r, err := OpenRotatingFile(filepath.Join(dir, "server.log"))
+  if err != nil { t.Fatal( err ) }
+  defer r.Close()
+
+  old := r.backupName(time.Now().Add(-48 * time.Hour))
+  err = ioutil.WriteFile(old, []byte("old\n"), 0660)
+  if err != nil { t.Fatal( err ) }
+
+  r.MaxAge = 24 * time.Hour
+  r.MaxBackups = 2
+  r.Compress = true
+
+  for i := 0; i < 3; i++ {
+    r.Write([]byte("line\n"))
+    err = r.Rotate()
+    if err != nil { t.Fatal( err ) }
+    time.Sleep(2 * time.Millisecond)
+  }
+  r.mill()
+
+  backups := r.backups()
+  testAssertEqual(t, 2, len(backups))
+
+  f, err := os.Open(backups[0])
+  if err != nil { t.Fatal( err ) }
+  defer f.Close()
+
+  gz, err := gzip.NewReader(f)
+  if err != nil { t.Fatal( err ) }
+  data, err := ioutil.ReadAll(gz)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "line\n", string(data))
+
+  _, err = os.Stat(old)
+  testAssertEqual(t, true, os.IsNotExist(err))
+}
+
+
+func TestRotatingFileReopen(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  path := filepath.Join(dir, "server.log")
+  r, err := OpenRotatingFile(path)
+  if err != nil { t.Fatal( err ) }
+  defer r.Close()
+
+  r.Write([]byte("before\n"))
+  err = os.Rename(path, path + ".1")
+  if err != nil { t.Fatal( err ) }
+
+  err = r.Reopen()
+  if err != nil { t.Fatal( err ) }
+  r.Write([]byte("after\n"))
+
+  data, err := ioutil.ReadFile(path)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "after\n", string(data))
+
+  data, err = ioutil.ReadFile(path + ".1")
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, "before\n", string(data))
+}
+
+
+func TestRotatingFileConcurrentWrites(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  r, err := OpenRotatingFile(filepath.Join(dir, "server.log"))
+  if err != nil { t.Fatal( err ) }
+  defer r.Close()
+  r.MaxSize = 100
+
+  wg := sync.WaitGroup{}
+  for i := 0; i < 10; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for j := 0; j < 50; j++ { r.Write([]byte("0123456789\n")) }
+    }()
+  }
+  wg.Wait()
+  r.mill()
+
+  total := 0
+  for _, name := range append(r.backups(), r.Path) {
+    data, err := ioutil.ReadFile(name)
+    if err != nil { t.Fatal( err ) }
+    if len(data) > 100 { t.Fatalf("Expected %s under 100 bytes, got %d", name, len(data)) }
+    total += len(data)
+  }
+  testAssertEqual(t, 10 * 50 * 11, total)
+}
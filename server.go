@@ -2,6 +2,7 @@ package gosrv
 
 import (
   "fmt"
+  "io"
   "net"
   "net/http"
   "os"
@@ -9,6 +10,8 @@ import (
   "time"
   "crypto/tls"
   "os/signal"
+  "strings"
+  "sync"
 )
 
 
@@ -18,6 +21,7 @@ import (
 type Server struct {
   *http.Server
   *Mux
+  Events      *EventLogger
   Config      *Config
   PidFile     string
   Env         string
@@ -25,13 +29,23 @@ type Server struct {
   KeyFile     string
   listener    net.Listener
   sigchan     chan os.Signal
+  ctlchan     chan os.Signal
+  logFile     io.WriteCloser
+  asyncLog    *AsyncWriter
+  logSinks    *MultiLogger
+  sinkFiles   []io.WriteCloser
+  errorFile   io.WriteCloser
+  logLock     sync.Mutex
+  logsDropped map[interface{}]int64
+  cli         *parsedFlag
 }
 
 
 // Creates a new Server instance with an optional environment name.
 // The default environment is "dev".
 func New(env ...string) *Server {
-  s := &Server{PidFile: DefaultPidFile, sigchan: make(chan os.Signal)}
+  s := &Server{PidFile: DefaultPidFile, sigchan: make(chan os.Signal),
+    ctlchan: make(chan os.Signal, 1)}
 
   if len(env) > 0 && env[0] != "" {
     s.Env = env[0]
@@ -42,8 +56,11 @@ func New(env ...string) *Server {
   }
 
   mux := NewMux()
-  s.Server = &http.Server{Handler: mux}
+  s.Events = NewEventLogger(os.Stderr)
+  s.Server = &http.Server{Handler: mux, ErrorLog: s.Events.StdLogger(ErrorLevel),
+    ConnContext: ConnContext}
   s.Mux    = mux
+  s.Mux.Events = s.Events
   s.Config = NewConfig(s.Env)
 
   return s
@@ -60,10 +77,47 @@ func New(env ...string) *Server {
 //  * writeTimeout    Server write timeout (default to net/http default)
 //  * maxHeaderBytes  Max header bytes allowed (default to net/http default)
 //  * logFormat       Log format to write in (default to DefaultLogFormat)
-//  * logFile         File to write request logs to (default stdout)
+//  * logFile         File, syslog:// or journald target for request logs (default stdout)
+//  * logMaxSize      Rotate logFile above this size in megabytes (default none)
+//  * logMaxAge       Remove rotated logs older than this duration (default none)
+//  * logMaxBackups   Number of rotated logs to keep (default all)
+//  * logCompress     Gzip rotated logs (default false)
+//  * logRotateDaily  Rotate logFile when the day changes (default false)
+//  * errorLogFile    File or syslog target for server events and errors (default stderr)
+//  * logFilter       Requests to log, see ParseLogFilter (default all)
+//  * logSkip         Requests never logged, e.g. /health,ua:kube-probe (default none)
+//  * logSample       Rates requests are logged at, e.g. 2xx:0.1 (default all)
+//  * logSlowThreshold  Requests this slow are written to the access log
+//                    despite logSkip and logSample (default 1s)
+//  * log.<name>.*    Additional request log sink with its own file, format,
+//                    encoding, fields, timeFormat, filter, skip, sample and
+//                    async keys
+//  * logAsync        Write request logs in the background (default false)
+//  * logBufferSize   Request log lines queued with logAsync (default 1024)
+//  * logFlushInterval  How often logAsync lines are flushed (default 1s)
+//  * logOverflow     When the logAsync queue is full: block or drop (default block)
+//  * syslogFacility  Syslog facility, e.g. local0 (default user)
+//  * syslogTag       Syslog tag (default app name)
+//  * syslogSeverity  Syslog severity of log lines (default info)
+//  * logRedact       Redact sensitive data from request logs (default true)
+//  * logRedactParams   Query parameters to redact, added to DefaultRedactParams
+//  * logRedactHeaders  Headers to redact, added to DefaultRedactHeaders
+//  * logRedactPattern.<name> Regexp to redact, added to DefaultRedactPatterns
+//  * logLevel        Minimum event level: debug, info, warn, error (default info)
+//  * logEncoding     Log line encoding: text, json or logfmt (default text)
+//  * logFields       Fields written by json and logfmt (default logFormat keys)
 //  * timeFormat      Time format for logs (default to DefaultTimeFormat)
+//  * requestIdFormat Format of generated request IDs: uuid4, ulid or ksuid
+//                    (default uuid4)
+//  * trustRequestIds IPs or CIDRs whose X-Request-Id is kept, or * (default none)
+//  * slowRequestWarnAfter  Log a warning event for requests still running
+//                    after this (default none)
+//  * slowRequestStacks  Include the handler stack in slow request warnings
+//                    (default false)
 //  * certFile        TLS cert file (default none)
 //  * keyFile         TLS key file (default none)
+//
+// Each key may also be set with an environment variable, see Config.
 func NewFromConfig(config_file string, env ...string) (*Server, error) {
   s := New()
 
@@ -71,92 +125,76 @@ func NewFromConfig(config_file string, env ...string) (*Server, error) {
 
   cfg, err := ReadConfig(config_file, s.Env)
   if err != nil { return nil, err }
-  s.Config = cfg
-
-  pidFile, err := cfg.String("pidFile")
-  if err == nil && pidFile != "" { s.PidFile = pidFile }
-
-  readTimeout, _ := cfg.String("readTimeout")
-  rt, err := time.ParseDuration(readTimeout)
-  if err == nil { s.ReadTimeout = rt }
-
-  writeTimeout, _ := cfg.String("writeTimeout")
-  wt, err := time.ParseDuration(writeTimeout)
-  if err == nil { s.WriteTimeout = wt }
-
-  maxHeaderBytes, err := cfg.Int("maxHeaderBytes")
-  if err == nil { s.MaxHeaderBytes = maxHeaderBytes }
-
-  addr, err := cfg.String("addr")
-  if err == nil { s.Addr = addr }
 
-  logFormat, err := cfg.String("logFormat")
-  if err == nil { s.Logger.SetLogFormat(logFormat) }
-
-  timeFormat, err := cfg.String("timeFormat")
-  if err == nil { s.Logger.SetTimeFormat(timeFormat) }
-
-  logFile, err := cfg.String("logFile")
-  if err == nil {
-    f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
-    if err != nil { return s, err }
-    s.Logger.SetWriter(f)
-  }
-
-  certFile, err := cfg.String("certFile")
-  if err == nil { s.CertFile = certFile }
-
-  keyFile, err := cfg.String("keyFile")
-  if err == nil { s.KeyFile = keyFile }
-
-  return s, nil
+  err = s.loadConfig(cfg)
+  return s, err
 }
 
 
 // Reads command line arguments to create a new Server instance. Uses a
 // config file if provided to the -c option. Command line arguments
-// override config values.
+// override config values. Application flags may be added with Flags.
+//
+// The first argument may name a command to run, see Commands. Commands other
+// than "start" exit the process when done.
 func NewFromFlag(args ...string) (*Server, error) {
-  var s *Server
-  var err error
-
   if len(args) == 0 { args = os.Args }
-  f := parseFlag(args)
+
+  f, err := parseFlag(args)
+  if err != nil { return nil, err }
 
   env := ""
   if !ForceProdEnv { env = f.env }
 
+  s := New(env)
+  cfg := NewConfig(s.Env)
+
   if f.configFile != "" {
-    s, err = NewFromConfig(f.configFile, env)
-    if err != nil && f.configFile != DefaultConfigFile { return s, err }
+    c, err := ReadConfig(f.configFile, s.Env)
+    if err != nil && f.given["c"] && f.command != "config" { return nil, err }
+    if err == nil { cfg = c }
+    f.configErr = err
   }
 
-  if s == nil { s = New(env) }
+  for key, val := range f.bound { cfg.Set(key, val) }
+  for _, pair := range f.settings { cfg.Set(pair[0], pair[1]) }
 
-  if f.pidFile != "" && f.pidFile != DefaultPidFile { s.PidFile = f.pidFile }
-  if f.addr != "" && f.addr != DefaultAddr { s.Addr = f.addr }
+  if f.given["pid"] { cfg.Set("pidFile", f.pidFile) }
+  if f.given["a"] { cfg.Set("addr", f.addr) }
 
-  if f.stopServer || f.restartServer || f.killServer {
-    fmt.Println("Stopping server...")
-
-    err := s.StopOther(f.killServer)
-    if err != nil { return s, err }
-
-    fmt.Println("\nServer stopped!\n")
-    if f.stopServer { os.Exit(0) }
+  s.cli = f
+  if cmd := Commands[f.command]; cmd != nil && cmd.BeforeLoad {
+    s.Config = cfg
+    s.loadPidFile(cfg)
+    s.runCommand(false)
   }
 
-  if f.restartServer || f.daemonizeServer {
-    daemonize(args)
-    os.Exit(0)
-  }
+  err = s.loadConfig(cfg)
+  if err != nil { return s, err }
 
+  s.runCommand(false)
   return s, nil
 }
 
 
+// Prints config errors and exits with a non-zero status if any were found.
+func checkConfig(cfg *Config, err error) {
+  if err != nil { exit(1, err.Error()) }
+
+  errs := cfg.Check()
+  for _, err := range errs { fmt.Println(err) }
+
+  if len(errs) > 0 { exit(1, "Config has %d error(s).", len(errs)) }
+  exit(0, "Config OK")
+}
+
+
 // Starts the server and listens on the given server.Addr.
 func (s *Server) ListenAndServe() error {
+  // Commands run before the port is bound, e.g. to list the routes while
+  // the server is running.
+  s.runCommand(true)
+
   if s.CertFile != "" && s.KeyFile != "" {
     return s.ListenAndServeTLS(s.CertFile, s.KeyFile)
 
@@ -166,7 +204,7 @@ func (s *Server) ListenAndServe() error {
     l, e := net.Listen("tcp", s.Addr)
     if e != nil { return e }
 
-    s.Logger.Printf("Server %s listening...\n", s.Addr)
+    s.logListening()
 
     return s.Serve(l)
   }
@@ -175,6 +213,7 @@ func (s *Server) ListenAndServe() error {
 
 // Starts the server with the given TLS files and listens on server.Addr.
 func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+  s.runCommand(true)
   if s.Addr == "" { s.Addr = ":https" }
 
   config := &tls.Config{}
@@ -191,22 +230,32 @@ func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
   conn, err := net.Listen("tcp", s.Addr)
   if err != nil { return err }
 
-  s.Logger.Printf("Server %s listening...\n", s.Addr)
+  s.logListening()
 
   tlsListener := tls.NewListener(conn, config)
   return s.Serve(tlsListener)
 }
 
 
-// Starts the server for the given listener.
+func (s *Server) logListening() {
+  s.Events.Log(InfoLevel, "Server listening", "addr", s.Addr,
+    "version", ReadBuildInfo().Version, "env", s.Env)
+}
+
+
+// Starts the server for the given listener, or runs the command given on
+// the command line that should run instead, e.g. routes.
 func (s *Server) Serve(l net.Listener) error {
+  s.runCommand(true)
   s.Stop()
 
   err := s.prepare()
 
   if err == nil {
     s.listener = l
+    stop := s.watchDroppedLogs()
     err = s.Server.Serve(l)
+    close(stop)
   }
 
   return s.finish(err)
@@ -214,7 +263,7 @@ func (s *Server) Serve(l net.Listener) error {
 
 
 // Writes the server's pidfile. Typically called at server Listen time.
-func (s Server) WritePidFile() error {
+func (s *Server) WritePidFile() error {
   if s.PidFile == "" { return nil }
 
   pidStr := fmt.Sprintf("%d", os.Getpid())
@@ -238,16 +287,20 @@ func (s Server) WritePidFile() error {
 
 // Removes the server's pidfile. The pidfile is automatically deleted when
 // an interrupt signal is received.
-func (s Server) DeletePidFile() error {
+func (s *Server) DeletePidFile() error {
   _, err := os.Stat(s.PidFile)
   if err != nil { return nil }
   return os.Remove(s.PidFile)
 }
 
 
-// Stop the server running at server.PidFile.
-func (s *Server) StopOther(force bool) error {
-  err := stopProcessAt(s.PidFile, force)
+// Stop the server running at server.PidFile, waiting for an optional
+// timeout (default 10s) before asking to force it.
+func (s *Server) StopOther(force bool, timeout ...time.Duration) error {
+  wait := 10 * time.Second
+  if len(timeout) > 0 { wait = timeout[0] }
+
+  err := stopProcessAt(s.PidFile, force, wait)
   if err == nil {
     err = s.DeletePidFile() }
   return err
@@ -266,7 +319,7 @@ func (s *Server) Stop() {
   s.listener.Close()
 
   s.rwlock.Lock()
-  s.Logger.Printf("Server %s stopping...\n", s.Addr)
+  s.Events.Log(InfoLevel, "Server stopping", "addr", s.Addr)
   s.stopped = true
   s.rwlock.Unlock()
 }
@@ -282,6 +335,574 @@ func (s *Server) Running() bool {
 }
 
 
+// Re-reads the config file and secret files and applies its logging
+// settings. Called when the server receives a SIGHUP signal, e.g. from the
+// reload command.
+func (s *Server) Reload() error {
+  cfg := s.CurrentConfig()
+  if cfg.file != "" {
+    c, err := ReadConfig(cfg.file, cfg.Env)
+    if err != nil { return err }
+
+    c.EnvPrefix = cfg.EnvPrefix
+    for key, val := range cfg.overrides { c.Set(key, val) }
+    cfg = c
+  }
+
+  // Secret files are read again, e.g. after a credential rotation.
+  cfg.secrets.clear()
+
+  s.logLock.Lock()
+  defer s.logLock.Unlock()
+
+  s.Config = cfg
+  return s.loadLogConfig(cfg)
+}
+
+
+// Returns the server config. Handlers should use it rather than s.Config,
+// which Reload replaces while requests are served.
+func (s *Server) CurrentConfig() *Config {
+  s.logLock.Lock()
+  defer s.logLock.Unlock()
+  return s.Config
+}
+
+
+// Applies the given config to the server and its logger.
+func (s *Server) loadConfig(cfg *Config) error {
+  s.logLock.Lock()
+  defer s.logLock.Unlock()
+
+  s.Config = cfg
+  s.loadPidFile(cfg)
+
+  readTimeout, _ := cfg.String("readTimeout")
+  rt, err := time.ParseDuration(readTimeout)
+  if err == nil { s.ReadTimeout = rt }
+
+  writeTimeout, _ := cfg.String("writeTimeout")
+  wt, err := time.ParseDuration(writeTimeout)
+  if err == nil { s.WriteTimeout = wt }
+
+  maxHeaderBytes, err := cfg.Int("maxHeaderBytes")
+  if err == nil { s.MaxHeaderBytes = maxHeaderBytes }
+
+  addr, err := cfg.String("addr")
+  if err == nil { s.Addr = addr }
+
+  certFile, err := cfg.String("certFile")
+  if err == nil { s.CertFile = certFile }
+
+  keyFile, err := cfg.String("keyFile")
+  if err == nil { s.KeyFile = keyFile }
+
+  requestIdFormat, err := cfg.String("requestIdFormat")
+  if err == nil {
+    err = s.Mux.SetRequestIdFormat(requestIdFormat)
+    if err != nil { return err }
+  }
+
+  trusted, err := cfg.List("trustRequestIds")
+  if err == nil {
+    err = s.Mux.TrustRequestIds(trusted...)
+    if err != nil { return err }
+  }
+
+  warnAfter, _ := cfg.String("slowRequestWarnAfter")
+  slow, err := time.ParseDuration(warnAfter)
+  if err == nil {
+    stacks, _ := cfg.Bool("slowRequestStacks")
+    s.Mux.SetSlowRequestThreshold(slow, stacks)
+  }
+
+  return s.loadLogConfig(cfg)
+}
+
+
+func (s *Server) loadPidFile(cfg *Config) {
+  pidFile, err := cfg.String("pidFile")
+  if err == nil && pidFile != "" { s.PidFile = pidFile }
+}
+
+
+// Applies the log config. Must be called with the log lock held.
+func (s *Server) loadLogConfig(cfg *Config) error {
+  logger := s.accessLogger()
+
+  err := configureHttpLogger(logger, cfg, "")
+  if err != nil { return err }
+
+  logLevel, err := cfg.String("logLevel")
+  if err == nil {
+    level, err := ParseLogLevel(logLevel)
+    if err != nil { return err }
+    s.Events.SetLevel(level)
+  }
+
+  f, err := openLogFile(cfg, "logFile")
+  if err != nil { return err }
+
+  async, err := s.openAsyncLog(cfg, f)
+  if err != nil {
+    if f != nil { f.Close() }
+    return err
+  }
+
+  // Access logs sent to slog with SetSlogLogger don't go to logFile.
+  s.Mux.rwlock.RLock()
+  slogged := s.Mux.slog != nil
+  s.Mux.rwlock.RUnlock()
+
+  if (f != nil || async != nil || s.asyncLog != nil) && !slogged {
+    var wr io.Writer = os.Stdout
+    if f != nil { wr = f } else if s.logFile != nil { wr = s.logFile }
+    if async != nil { wr = async }
+    logger.SetWriter(wr)
+  }
+
+  s.closeAsyncLog()
+  s.asyncLog = async
+
+  if f != nil {
+    if s.logFile != nil {
+      s.logFile.Close()
+      s.logClosedDropped(s.logFile)
+    }
+    s.logFile = f
+  }
+
+  f, err = openLogFile(cfg, "errorLogFile")
+  if err != nil { return err }
+  if f != nil {
+    s.Events.SetWriter(f)
+
+    if s.errorFile != nil { s.errorFile.Close() }
+    s.errorFile = f
+  }
+
+  return s.loadLogSinks(cfg, logger)
+}
+
+
+// Applies the format, time format, encoding and fields config to the given
+// logger, from the top-level keys or the sink keys with the given prefix,
+// e.g. "log.json.format".
+func configureHttpLogger(logger HttpLogger, cfg *Config, prefix string) error {
+  key := func(top, sink string) string {
+    if prefix == "" { return top }
+    return prefix + sink
+  }
+
+  logFormat, err := cfg.String(key("logFormat", "format"))
+  if err == nil { logger.SetLogFormat(logFormat) }
+
+  timeFormat, err := cfg.String(key("timeFormat", "timeFormat"))
+  if err != nil { timeFormat, err = cfg.String("timeFormat") }
+  if err == nil { logger.SetTimeFormat(timeFormat) }
+
+  logEncoding, err := cfg.String(key("logEncoding", "encoding"))
+  if err == nil {
+    err = logger.SetLogEncoding(logEncoding)
+    if err != nil { return err }
+  }
+
+  logFields, err := cfg.List(key("logFields", "fields"))
+  if err == nil {
+    err = logger.SetLogFields(logFields)
+    if err != nil { return err }
+  }
+
+  redactor, err := configLogRedactor(cfg)
+  if err != nil { return err }
+  logger.SetRedactor(redactor)
+
+  return nil
+}
+
+
+// Returns the redactor of all log sinks: the defaults plus the
+// logRedactParams, logRedactHeaders and logRedactPattern.<name> keys, or
+// nil when logRedact is false.
+func configLogRedactor(cfg *Config) (*LogRedactor, error) {
+  enabled, err := cfg.Bool("logRedact")
+  if err == nil && !enabled { return nil, nil }
+
+  params, _ := cfg.List("logRedactParams")
+  headers, _ := cfg.List("logRedactHeaders")
+  patterns := []string{}
+  for _, v := range cfg.Values() {
+    if wildcardConfigKey(v.Key) != "logRedactPattern.*" || v.Key == "logRedactPattern.*" { continue }
+
+    // One pattern per key, as regexps may contain commas, e.g. \d{3,4}.
+    pattern, err := cfg.String(v.Key)
+    if err != nil { continue }
+
+    err = validateLogRedactPattern(pattern)
+    if err != nil { return nil, mkerr("Invalid %s: %v.", v.Key, err) }
+    patterns = append(patterns, pattern)
+  }
+
+  if len(params) + len(headers) + len(patterns) == 0 {
+    r, err := DefaultLogRedactor()
+    if err != nil { return nil, mkerr("Invalid log redaction: %v.", err) }
+    return r, nil
+  }
+
+  r, err := NewLogRedactor(append(params, DefaultRedactParams...),
+    append(headers, DefaultRedactHeaders...), append(patterns, DefaultRedactPatterns...))
+  if err != nil { return nil, mkerr("Invalid log redaction: %v.", err) }
+  return r, nil
+}
+
+
+// Returns the logger configured by the top-level log keys, which is the
+// default sink when log sinks are configured.
+func (s *Server) accessLogger() HttpLogger {
+  if s.logSinks != nil {
+    if sink := s.logSinks.Sink(DefaultLogSink); sink != nil { return sink.Logger }
+  }
+  return s.Logger
+}
+
+
+// Sets up the log sinks configured with log.<name>.* keys, logging with a
+// MultiLogger alongside the given default logger.
+func (s *Server) loadLogSinks(cfg *Config, logger HttpLogger) error {
+  names := logSinkNames(cfg)
+
+  filter, err := configLogFilter(cfg, "")
+  if err != nil { return err }
+
+  if filter == nil && len(names) == 0 {
+    if s.logSinks != nil { s.setLogger(logger, nil, nil) }
+    return nil
+  }
+
+  multi := NewMultiLogger(&LogSink{DefaultLogSink, logger, filter})
+  files := []io.WriteCloser{}
+
+  for _, name := range names {
+    sink, ws, err := openLogSink(cfg, name)
+    files = append(files, ws...)
+    if err != nil {
+      for _, f := range files { f.Close() }
+      return err
+    }
+    multi.AddSink(name, sink.Logger, sink.Filter)
+  }
+
+  s.setLogger(multi, multi, files)
+  return nil
+}
+
+
+// Returns the log sink with the given name and the writers to close with
+// it: its AsyncWriter, if async, followed by its file.
+func openLogSink(cfg *Config, name string) (*LogSink, []io.WriteCloser, error) {
+  prefix := "log." + name + "."
+  sink := &LogSink{Name: name, Logger: NewHttpLogger(os.Stdout)}
+
+  err := configureHttpLogger(sink.Logger, cfg, prefix)
+  if err != nil { return nil, nil, err }
+
+  sink.Filter, err = configLogFilter(cfg, prefix)
+  if err != nil { return nil, nil, err }
+
+  f, err := openLogFile(cfg, prefix + "file")
+  if err != nil { return nil, nil, err }
+
+  var wr io.Writer = os.Stdout
+  ws := []io.WriteCloser{}
+  if f != nil { wr, ws = f, []io.WriteCloser{f} }
+
+  async, err := configAsyncWriter(cfg, prefix + "async", wr)
+  if err != nil { return nil, ws, err }
+  if async != nil { wr, ws = async, append([]io.WriteCloser{async}, ws...) }
+
+  if len(ws) > 0 { sink.Logger.SetWriter(wr) }
+  return sink, ws, nil
+}
+
+
+// Returns the filter of the log sink with the given key prefix, combining
+// its filter, skip and sample keys, or nil to log all requests.
+func configLogFilter(cfg *Config, prefix string) (LogFilter, error) {
+  key := func(top, sink string) string {
+    if prefix == "" { return top }
+    return prefix + sink
+  }
+
+  var filter LogFilter
+  expr, err := cfg.String(key("logFilter", "filter"))
+  if err == nil {
+    filter, err = ParseLogFilter(expr)
+    if err != nil { return nil, mkerr("Invalid %s: %v.", key("logFilter", "filter"), err) }
+  }
+
+  skip, _ := cfg.List(key("logSkip", "skip"))
+  sample, _ := cfg.List(key("logSample", "sample"))
+  if len(skip) == 0 && len(sample) == 0 { return filter, nil }
+
+  keepSlow := DefaultLogSlowThreshold
+  threshold, err := cfg.String("logSlowThreshold")
+  if err == nil {
+    keepSlow, err = time.ParseDuration(threshold)
+    if err != nil { return nil, mkerr("Invalid logSlowThreshold value %q.", threshold) }
+  }
+
+  sampling, err := NewSamplingFilter(skip, sample, keepSlow)
+  if err != nil { return nil, mkerr("Invalid %s or %s: %v.", key("logSkip", "skip"), key("logSample", "sample"), err) }
+
+  return AllLogFilters(filter, sampling), nil
+}
+
+
+// Replaces the logger of the top-level log keys, keeping the filter of its
+// sink and the other log sinks.
+func (s *Server) setAccessLogger(logger HttpLogger) {
+  if s.logSinks == nil {
+    s.Mux.rwlock.Lock()
+    s.Mux.Logger = logger
+    s.Mux.rwlock.Unlock()
+    return
+  }
+
+  sinks := s.logSinks.Sinks()
+  for i, sink := range sinks {
+    if sink.Name == DefaultLogSink { sinks[i] = &LogSink{sink.Name, logger, sink.Filter} }
+  }
+
+  multi := NewMultiLogger(sinks...)
+  s.Mux.rwlock.Lock()
+  s.Mux.Logger = multi
+  s.Mux.rwlock.Unlock()
+  s.logSinks = multi
+}
+
+
+// Swaps the Mux logger and the log sinks, closing the files of the
+// previous sinks.
+func (s *Server) setLogger(logger HttpLogger, sinks *MultiLogger, files []io.WriteCloser) {
+  s.Mux.rwlock.Lock()
+  s.Mux.Logger = logger
+  s.Mux.rwlock.Unlock()
+
+  for _, f := range s.sinkFiles {
+    f.Close()
+    s.logClosedDropped(f)
+  }
+  s.logSinks = sinks
+  s.sinkFiles = files
+}
+
+
+// Returns the sorted names of the sinks configured with log.<name>.* keys.
+func logSinkNames(cfg *Config) []string {
+  names := map[string]interface{}{}
+  for _, v := range cfg.Values() {
+    parts := strings.Split(v.Key, ".")
+    if len(parts) == 3 && parts[0] == "log" && parts[1] != "*" { names[parts[1]] = nil }
+  }
+  return sortedKeys(names)
+}
+
+
+// Returns an AsyncWriter writing to the given log file, or the current one
+// or stdout if nil, when logAsync is set.
+func (s *Server) openAsyncLog(cfg *Config, f io.Writer) (*AsyncWriter, error) {
+  var wr io.Writer = os.Stdout
+  if f != nil { wr = f } else if s.logFile != nil { wr = s.logFile }
+
+  return configAsyncWriter(cfg, "logAsync", wr)
+}
+
+
+// Returns an AsyncWriter writing to wr when the given key, or logAsync if
+// it isn't set, is true. Sinks share the logAsync buffer settings.
+func configAsyncWriter(cfg *Config, key string, wr io.Writer) (*AsyncWriter, error) {
+  async, err := cfg.Bool(key)
+  if err != nil { async, err = cfg.Bool("logAsync") }
+  if err != nil || !async { return nil, nil }
+
+  size, _ := cfg.Int("logBufferSize")
+
+  flushInterval, _ := cfg.String("logFlushInterval")
+  interval, _ := time.ParseDuration(flushInterval)
+
+  overflow, err := cfg.String("logOverflow")
+  if err == nil && validateLogOverflow(overflow) != nil {
+    return nil, mkerr("Invalid logOverflow value %q, must be block or drop.", overflow) }
+
+  return NewAsyncWriter(wr, size, interval, overflow), nil
+}
+
+
+// Flushes and stops the async access log writer, reporting dropped lines.
+func (s *Server) closeAsyncLog() {
+  if s.asyncLog == nil { return }
+
+  s.asyncLog.Close()
+  s.logClosedDropped(s.asyncLog)
+  s.asyncLog = nil
+}
+
+
+// Logs the number of lines dropped by the given log writer since the last
+// report, if any. Must be called with the log lock held.
+func (s *Server) logDropped(w interface{}) {
+  d, ok := w.(interface{ Dropped() int64 })
+  if !ok { return }
+
+  dropped := d.Dropped()
+  count := dropped - s.logsDropped[w]
+  if count <= 0 { return }
+
+  if s.logsDropped == nil { s.logsDropped = map[interface{}]int64{} }
+  s.logsDropped[w] = dropped
+  s.Events.Log(WarnLevel, "Access log lines dropped", "count", count)
+}
+
+
+// Logs the lines dropped by the given log writer before it was closed.
+func (s *Server) logClosedDropped(w interface{}) {
+  s.logDropped(w)
+  delete(s.logsDropped, w)
+}
+
+
+// Logs the lines dropped by all access log writers since the last report.
+func (s *Server) reportDroppedLogs() {
+  s.logLock.Lock()
+  defer s.logLock.Unlock()
+  for _, w := range s.logWriters() { s.logDropped(w) }
+}
+
+
+// Reports dropped access log lines every DroppedLogInterval until the
+// returned channel is closed.
+func (s *Server) watchDroppedLogs() chan bool {
+  stop := make(chan bool)
+  go func() {
+    ticker := time.NewTicker(DroppedLogInterval)
+    defer ticker.Stop()
+
+    for {
+      select {
+      case <- stop:
+        return
+      case <- ticker.C:
+        s.reportDroppedLogs()
+      }
+    }
+  }()
+  return stop
+}
+
+
+// Returns the access log writers, including logFile and those of log
+// sinks. Must be called with the log lock held.
+func (s *Server) logWriters() []io.Writer {
+  ws := []io.Writer{}
+  if s.asyncLog != nil { ws = append(ws, s.asyncLog) }
+  if s.logFile != nil { ws = append(ws, s.logFile) }
+  for _, f := range s.sinkFiles { ws = append(ws, f) }
+  return ws
+}
+
+
+// Writes access log lines queued with logAsync, of all log sinks.
+func (s *Server) FlushLogs() error {
+  s.logLock.Lock()
+  defer s.logLock.Unlock()
+
+  for _, w := range s.logWriters() {
+    f, ok := w.(interface{ Flush() error })
+    if !ok { continue }
+
+    err := f.Flush()
+    if err != nil { return err }
+  }
+  return nil
+}
+
+
+// Opens the log file or syslog target set by the given config key with the
+// configured rotation or syslog settings. Returns nil if the key isn't set.
+func openLogFile(cfg *Config, key string) (io.WriteCloser, error) {
+  logFile, err := cfg.String(key)
+  if err != nil { return nil, nil }
+
+  if IsSyslogTarget(logFile) { return openSyslog(cfg, logFile) }
+
+  f, err := OpenRotatingFile(logFile)
+  if err != nil { return nil, err }
+
+  maxSize, err := cfg.Int("logMaxSize")
+  if err == nil { f.MaxSize = int64(maxSize) << 20 }
+
+  maxAge, _ := cfg.String("logMaxAge")
+  age, err := time.ParseDuration(maxAge)
+  if err == nil { f.MaxAge = age }
+
+  maxBackups, err := cfg.Int("logMaxBackups")
+  if err == nil { f.MaxBackups = maxBackups }
+
+  compress, err := cfg.Bool("logCompress")
+  if err == nil { f.Compress = compress }
+
+  daily, err := cfg.Bool("logRotateDaily")
+  if err == nil { f.Daily = daily }
+
+  return f, nil
+}
+
+
+func openSyslog(cfg *Config, target string) (io.WriteCloser, error) {
+  facility, severity := -1, -1
+
+  name, err := cfg.String("syslogFacility")
+  if err == nil {
+    facility, err = ParseSyslogFacility(name)
+    if err != nil { return nil, err }
+  }
+
+  name, err = cfg.String("syslogSeverity")
+  if err == nil {
+    severity, err = ParseSyslogSeverity(name)
+    if err != nil { return nil, err }
+  }
+
+  w, err := DialSyslog(target)
+  if err != nil { return nil, err }
+
+  if facility >= 0 { w.Facility = facility }
+  if severity >= 0 { w.Severity = severity }
+
+  tag, err := cfg.String("syslogTag")
+  if err == nil && tag != "" { w.Tag = tag }
+
+  return w, nil
+}
+
+
+// Closes and reopens the log files, e.g. after they were moved by
+// logrotate. Called when the server receives a SIGUSR1 signal, e.g. from
+// the reopen command.
+func (s *Server) ReopenLogs() error {
+  s.logLock.Lock()
+  defer s.logLock.Unlock()
+
+  for _, f := range append([]io.WriteCloser{s.logFile, s.errorFile}, s.sinkFiles...) {
+    r, ok := f.(interface{ Reopen() error })
+    if !ok { continue }
+    err := r.Reopen()
+    if err != nil { return err }
+  }
+  return nil
+}
+
+
 func (s *Server) prepare() error {
   err := s.WritePidFile()
   if err != nil { return err }
@@ -292,6 +913,7 @@ func (s *Server) prepare() error {
     s.Stop()
   }()
 
+  s.notifyControl()
   return nil
 }
 
@@ -301,11 +923,31 @@ func (s *Server) waitForConnections() {
   go func() {
     _, ok := <- s.sigchan // block until signal is received
     if ok {
+      s.Events.Log(ErrorLevel, "Server forced shutdown", "addr", s.Addr,
+        "active", s.ActiveRequests())
+      s.FlushLogs()
       s.DeletePidFile()
       exit(1, "Forced shutdown: connections were interrupted")
     }
   }()
-  s.conns.Wait()
+
+  done := make(chan bool)
+  go func() {
+    s.conns.Wait()
+    close(done)
+  }()
+
+  ticker := time.NewTicker(DrainLogInterval)
+  defer ticker.Stop()
+
+  for {
+    select {
+    case <- done:
+      return
+    case <- ticker.C:
+      s.Events.Log(InfoLevel, "Server draining", "addr", s.Addr, "active", s.ActiveRequests())
+    }
+  }
 }
 
 
@@ -319,15 +961,25 @@ func (s *Server) finish(err error) error {
     if s.conns != nil { s.waitForConnections() }
   }
 
+  // The log lock is taken before the Mux lock, as in Reload.
+  s.FlushLogs()
+  s.reportDroppedLogs()
+
   s.rwlock.Lock()
   s.stopped = true
 
-  if err != nil { s.Logger.Printf(err.Error() + "\n") }
+  if err != nil {
+    s.Events.Log(ErrorLevel, "Server error", "addr", s.Addr, "error", err)
+  } else {
+    s.Events.Log(InfoLevel, "Server stopped", "addr", s.Addr)
+  }
 
   close(s.sigchan)
   s.listener = nil
 
   signal.Stop(s.sigchan)
+  signal.Stop(s.ctlchan)
+  close(s.ctlchan)
   err = s.DeletePidFile()
 
   s.rwlock.Unlock()
@@ -3,6 +3,12 @@ package gosrv
 import (
   "testing"
   "time"
+  "os"
+  "bytes"
+  "net/http"
+  "net/http/httptest"
+  "io/ioutil"
+  "strings"
 )
 
 
@@ -94,3 +100,434 @@ func TestNewFromFlagAndConfig(t *testing.T) {
   if err != nil { t.Fatal( err ) }
   testAssertEqual(t, "customValue", val)
 }
+
+
+func TestNewFromFlagEnvVar(t *testing.T) {
+  os.Setenv("GOSRV_TEST_ADDR", ":7001")
+  os.Setenv("GOSRV_TEST_WRITE_TIMEOUT", "3s")
+  defer os.Unsetenv("GOSRV_TEST_ADDR")
+  defer os.Unsetenv("GOSRV_TEST_WRITE_TIMEOUT")
+
+  s, err := NewFromFlag("test","-c","testdata/server.cfg","-e","prod")
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, ":7001", s.Addr)
+  testAssertEqual(t, 3 * time.Second, s.WriteTimeout)
+
+  s, err = NewFromFlag("test","-a",":7000","-c","testdata/server.cfg")
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, ":7000", s.Addr)
+}
+
+
+func TestNewFromFlagAppFlags(t *testing.T) {
+  oldFlags := Flags
+  defer func(){ Flags = oldFlags }()
+  Flags = NewFlagSet()
+
+  Flags.String("custom", "", "Custom config")
+  Flags.Bind("custom", "customConfig")
+
+  s, err := NewFromFlag("test","-c","testdata/server.cfg","-custom","flagValue")
+  if err != nil { t.Fatal( err ) }
+
+  val, _ := s.Config.String("customConfig")
+  testAssertEqual(t, "flagValue", val)
+  testAssertEqual(t, "flag", s.Config.Source("customConfig"))
+}
+
+
+func TestNewFromFlagSettings(t *testing.T) {
+  s, err := NewFromFlag("test","-c","testdata/server.cfg","-e","prod",
+              "-a",DefaultAddr,"-set","writeTimeout=3s","-set","customConfig=a=b")
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, DefaultAddr, s.Addr)
+  testAssertEqual(t, 3 * time.Second, s.WriteTimeout)
+
+  val, _ := s.Config.String("customConfig")
+  testAssertEqual(t, "a=b", val)
+  testAssertEqual(t, "flag", s.Config.Source("writeTimeout"))
+
+  _, err = NewFromFlag("test","-c",DefaultConfigFile)
+  if err == nil { t.Fatal( "Expected error for missing explicit config file" ) }
+}
+
+
+func TestLoadLogConfigRotation(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFile", dir + "/server.log")
+  cfg.Set("logMaxSize", "5")
+  cfg.Set("logMaxAge", "24h")
+  cfg.Set("logMaxBackups", "3")
+  cfg.Set("logCompress", "true")
+  cfg.Set("logRotateDaily", "yes")
+
+  s := New()
+  err := s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  defer s.logFile.Close()
+
+  f := s.logFile.(*RotatingFile)
+  testAssertEqual(t, int64(5 << 20), f.MaxSize)
+  testAssertEqual(t, 24 * time.Hour, f.MaxAge)
+  testAssertEqual(t, 3, f.MaxBackups)
+  testAssertEqual(t, true, f.Compress)
+  testAssertEqual(t, true, f.Daily)
+
+  err = s.ReopenLogs()
+  if err != nil { t.Fatal( err ) }
+}
+
+
+func TestLoadLogConfigErrorLog(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFile", dir + "/access.log")
+  cfg.Set("errorLogFile", dir + "/error.log")
+  cfg.Set("logLevel", "warn")
+
+  s := New()
+  err := s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  s.Events.Infof("hidden")
+  s.Events.Warnf("warning")
+  s.ErrorLog.Printf("http error")
+  s.logFile.Close()
+  s.errorFile.Close()
+
+  access, _ := ioutil.ReadFile(dir + "/access.log")
+  testAssertEqual(t, "", string(access))
+
+  errors, _ := ioutil.ReadFile(dir + "/error.log")
+  lines := strings.Split(strings.TrimSpace(string(errors)), "\n")
+  testAssertEqual(t, 2, len(lines))
+  testAssertEqual(t, true, strings.HasSuffix(lines[0], " WARN warning"))
+  testAssertEqual(t, true, strings.HasSuffix(lines[1], " ERROR http error"))
+
+  cfg.Set("logLevel", "loud")
+  err = s.loadLogConfig(cfg)
+  if err == nil { t.Fatal( "Expected invalid log level error" ) }
+}
+
+
+func TestLoadLogConfigAsync(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFile", dir + "/access.log")
+  cfg.Set("logAsync", "true")
+  cfg.Set("logFlushInterval", "1h")
+  cfg.Set("logOverflow", "drop")
+
+  s := New()
+  err := s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  defer s.logFile.Close()
+
+  s.Logger.Write([]byte("queued\n"))
+  access, _ := ioutil.ReadFile(dir + "/access.log")
+  testAssertEqual(t, "", string(access))
+
+  err = s.FlushLogs()
+  if err != nil { t.Fatal( err ) }
+  access, _ = ioutil.ReadFile(dir + "/access.log")
+  testAssertEqual(t, "queued\n", string(access))
+
+  cfg.Set("logAsync", "false")
+  err = s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, true, s.asyncLog == nil)
+
+  cfg.Set("logAsync", "true")
+  cfg.Set("logOverflow", "wait")
+  err = s.loadLogConfig(cfg)
+  if err == nil { t.Fatal( "Expected invalid logOverflow error" ) }
+}
+
+
+func TestWatchDroppedLogs(t *testing.T) {
+  interval := DroppedLogInterval
+  DroppedLogInterval = 10 * time.Millisecond
+  defer func() { DroppedLogInterval = interval }()
+
+  s := New()
+  events := &testSlowWriter{release: make(chan bool)}
+  close(events.release)
+  s.Events.SetWriter(events)
+
+  s.asyncLog = NewAsyncWriter(&testFailingWriter{fail: 1}, 4, time.Hour, BlockOnOverflow)
+  defer s.asyncLog.Close()
+  s.asyncLog.Write([]byte("lost\n"))
+  s.asyncLog.Flush()
+
+  stop := s.watchDroppedLogs()
+  for i := 0; i < 100 && !strings.Contains(events.String(), "dropped"); i++ {
+    time.Sleep(10 * time.Millisecond) }
+
+  // Each dropped line is reported once.
+  time.Sleep(50 * time.Millisecond)
+  close(stop)
+  testAssertEqual(t, 1, strings.Count(events.String(), "Access log lines dropped"))
+}
+
+
+func TestLoadLogConfigSinkAsync(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFile", dir + "/access.log")
+  cfg.Set("logAsync", "true")
+  cfg.Set("logFlushInterval", "1h")
+  cfg.Set("log.json.file", dir + "/access.json")
+  cfg.Set("log.json.encoding", "json")
+  cfg.Set("log.json.fields", "Status")
+  cfg.Set("log.sync.file", dir + "/sync.log")
+  cfg.Set("log.sync.format", "$Status")
+  cfg.Set("log.sync.async", "false")
+
+  s := New()
+  err := s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  defer s.logFile.Close()
+
+  testLogRequest(s.Logger, 200, "")
+
+  json, _ := ioutil.ReadFile(dir + "/access.json")
+  testAssertEqual(t, "", string(json))
+  sync, _ := ioutil.ReadFile(dir + "/sync.log")
+  testAssertEqual(t, "200\n", string(sync))
+
+  err = s.FlushLogs()
+  if err != nil { t.Fatal( err ) }
+  json, _ = ioutil.ReadFile(dir + "/access.json")
+  testAssertEqual(t, "{\"Status\":200}\n", string(json))
+  access, _ := ioutil.ReadFile(dir + "/access.log")
+  testAssertEqual(t, 1, strings.Count(string(access), "\n"))
+
+  // Reloading flushes the async writers of the replaced sinks.
+  testLogRequest(s.Logger, 201, "")
+  err = s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  json, _ = ioutil.ReadFile(dir + "/access.json")
+  testAssertEqual(t, "{\"Status\":200}\n{\"Status\":201}\n", string(json))
+
+  s.closeAsyncLog()
+  for _, f := range s.sinkFiles { f.Close() }
+}
+
+
+func TestLoadLogConfigSinks(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFormat", "$Status $RequestPath")
+  cfg.Set("logFilter", "path!=/health")
+  cfg.Set("log.json.file", dir + "/access.json")
+  cfg.Set("log.json.encoding", "json")
+  cfg.Set("log.json.fields", "Status")
+  cfg.Set("log.errors.file", dir + "/errors.log")
+  cfg.Set("log.errors.format", "$RequestMethod $RequestPath")
+  cfg.Set("log.errors.filter", "status>=500")
+
+  s := New()
+  buf := &bytes.Buffer{}
+  s.Logger.SetWriter(buf)
+
+  err := s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  testLogRequest(s.Logger, 200, "")
+  testLogRequest(s.Logger, 500, "")
+
+  req := httptest.NewRequest("GET", "/health", nil)
+  s.Logger.Log(time.Now(), NewResponse(httptest.NewRecorder(), s.Mux), req)
+
+  testAssertEqual(t, "200 /path\n500 /path\n", buf.String())
+
+  json, _ := ioutil.ReadFile(dir + "/access.json")
+  testAssertEqual(t, "{\"Status\":200}\n{\"Status\":500}\n{\"Status\":200}\n", string(json))
+
+  errors, _ := ioutil.ReadFile(dir + "/errors.log")
+  testAssertEqual(t, "GET /path\n", string(errors))
+
+  // Reloading applies top-level keys to the default sink only.
+  cfg.Set("logFormat", "$Status")
+  err = s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, 3, len(s.logSinks.Sinks()))
+  testAssertEqual(t, "$Status", s.accessLogger().(*httpLogger).logFormat)
+
+  cfg.Set("log.errors.filter", "size>1")
+  err = s.loadLogConfig(cfg)
+  if err == nil { t.Fatal( "Expected invalid filter error" ) }
+
+  for _, f := range s.sinkFiles { f.Close() }
+}
+
+
+func TestReloadConcurrent(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFile", dir + "/access.log")
+  cfg.Set("logAsync", "true")
+  cfg.Set("log.errors.file", dir + "/errors.log")
+
+  s := New()
+  err := s.loadConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  s.HandleFunc("/", func(wr http.ResponseWriter, req *http.Request) {})
+
+  done := make(chan error)
+  go func() {
+    for i := 0; i < 20; i++ {
+      err := s.Reload()
+      if err != nil { done <- err }
+    }
+    close(done)
+  }()
+
+  for running := true; running; {
+    select {
+    case err, ok := <- done:
+      if ok { t.Fatal( err ) }
+      running = false
+    default:
+    }
+
+    s.Mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+    s.ReopenLogs()
+    s.FlushLogs()
+    testAssertEqual(t, cfg, s.CurrentConfig())
+  }
+
+  s.closeAsyncLog()
+  s.logFile.Close()
+  for _, f := range s.sinkFiles { f.Close() }
+}
+
+
+func TestLoadLogConfigSampling(t *testing.T) {
+  cfg := NewConfig("dev")
+  cfg.Set("logFormat", "$Status $RequestPath")
+  cfg.Set("logSkip", "/health, /metrics")
+  cfg.Set("logSample", "2xx:0")
+
+  s := New()
+  buf := &bytes.Buffer{}
+  s.Logger.SetWriter(buf)
+
+  err := s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  req := httptest.NewRequest("GET", "/health", nil)
+  s.Logger.Log(time.Now(), NewResponse(httptest.NewRecorder(), s.Mux), req)
+  testLogRequest(s.Logger, 200, "")
+  testLogRequest(s.Logger, 404, "")
+  testLogRequest(s.Logger, 500, "")
+
+  testAssertEqual(t, "404 /path\n500 /path\n", buf.String())
+
+  cfg.Set("logSample", "2xx")
+  err = s.loadLogConfig(cfg)
+  if err == nil { t.Fatal( "Expected invalid logSample error" ) }
+}
+
+
+func TestLoadLogConfigRedaction(t *testing.T) {
+  cfg := NewConfig("dev")
+  cfg.Set("logFormat", "$RequestUri $Header[X-Session]")
+  cfg.Set("logRedactParams", "q")
+  cfg.Set("logRedactHeaders", "X-Session")
+
+  s := New()
+  buf := &bytes.Buffer{}
+  s.Logger.SetWriter(buf)
+
+  err := s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  req := httptest.NewRequest("GET", "/path?q=1&token=abc", nil)
+  req.Header.Set("X-Session", "abc")
+  s.Logger.Log(time.Now(), NewResponse(httptest.NewRecorder(), s.Mux), req)
+  testAssertEqual(t, "/path?q=[REDACTED]&token=[REDACTED] [REDACTED]\n", buf.String())
+
+  buf.Reset()
+  cfg.Set("logRedact", "false")
+  err = s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  s.Logger.Log(time.Now(), NewResponse(httptest.NewRecorder(), s.Mux), req)
+  testAssertEqual(t, "/path?q=1&token=abc abc\n", buf.String())
+
+  buf.Reset()
+  cfg.Set("logRedact", "true")
+  cfg.Set("logRedactPattern.phone", `\d{3,4}-\d{4}`)
+  err = s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, nil, checkConfigValue("logRedactPattern.phone", `\d{3,4}-\d{4}`))
+
+  req = httptest.NewRequest("GET", "/call/555-1234?q=1", nil)
+  req.Header.Set("X-Session", "abc")
+  s.Logger.Log(time.Now(), NewResponse(httptest.NewRecorder(), s.Mux), req)
+  testAssertEqual(t, "/call/[REDACTED]?q=[REDACTED] [REDACTED]\n", buf.String())
+
+  cfg.Set("logRedactPattern.bad", "(")
+  err = s.loadLogConfig(cfg)
+  if err == nil { t.Fatal( "Expected invalid logRedactPattern error" ) }
+}
+
+
+func TestLoadConfigRequestIds(t *testing.T) {
+  cfg := NewConfig("dev")
+  cfg.Set("requestIdFormat", "ulid")
+  cfg.Set("trustRequestIds", "192.0.2.0/24")
+
+  s := New()
+  err := s.loadConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  ids := []string{}
+  s.Logger.SetWriter(&bytes.Buffer{})
+  s.HandleFunc("/id", func(wr http.ResponseWriter, req *http.Request) { ids = append(ids, RequestId(req)) })
+
+  s.Mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/id", nil))
+
+  req := httptest.NewRequest("GET", "/id", nil)
+  req.Header.Set("X-Request-Id", "abc123")
+  s.Mux.ServeHTTP(httptest.NewRecorder(), req)
+
+  testAssertEqual(t, 26, len(ids[0]))
+  testAssertEqual(t, "abc123", ids[1])
+
+  cfg.Set("requestIdFormat", "uuid1")
+  err = s.loadConfig(cfg)
+  if err == nil { t.Fatal( "Expected invalid requestIdFormat error" ) }
+}
+
+
+func TestLoadConfigSlowRequest(t *testing.T) {
+  cfg := NewConfig("dev")
+  cfg.Set("slowRequestWarnAfter", "2s")
+  cfg.Set("slowRequestStacks", "true")
+
+  s := New()
+  err := s.loadConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  testAssertEqual(t, 2 * time.Second, s.Mux.slowThreshold)
+  testAssertEqual(t, true, s.Mux.slowStacks)
+  testAssertEqual(t, s.Events, s.Mux.Events)
+}
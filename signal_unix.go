@@ -0,0 +1,48 @@
+//go:build !windows
+
+package gosrv
+
+import (
+  "fmt"
+  "os/signal"
+  "syscall"
+)
+
+
+// Commands signaling the running server to reload or reopen its logs.
+var controlCommands = []Command {
+  {Name: "reload", Usage: "Reload the running server config and logs", BeforeLoad: true, Run: cmdReload},
+  {Name: "reopen", Usage: "Reopen the running server log files", BeforeLoad: true, Run: cmdReopen},
+}
+
+
+func cmdReload(s *Server, args []string) error {
+  err := signalProcessAt(s.PidFile, syscall.SIGHUP)
+  if err == nil { fmt.Println("Server reloading...") }
+  return err
+}
+
+
+func cmdReopen(s *Server, args []string) error {
+  err := signalProcessAt(s.PidFile, syscall.SIGUSR1)
+  if err == nil { fmt.Println("Server reopening logs...") }
+  return err
+}
+
+
+// Reloads the config on SIGHUP and reopens the log files on SIGUSR1.
+func (s *Server) notifyControl() {
+  signal.Notify(s.ctlchan, syscall.SIGHUP, syscall.SIGUSR1)
+  go func() {
+    for sig := range s.ctlchan {
+      if sig == syscall.SIGUSR1 {
+        err := s.ReopenLogs()
+        if err != nil { s.Events.Log(ErrorLevel, "Server log reopen failed", "addr", s.Addr, "error", err) }
+        continue
+      }
+
+      err := s.Reload()
+      if err != nil { s.Events.Log(ErrorLevel, "Server reload failed", "addr", s.Addr, "error", err) }
+    }
+  }()
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package gosrv
+
+
+// Windows processes can't be sent SIGHUP or SIGUSR1, so the running server
+// can't be told to reload or reopen its logs from the command line. Call
+// Server.Reload and Server.ReopenLogs from the app instead.
+var controlCommands = []Command{}
+
+
+func (s *Server) notifyControl() {}
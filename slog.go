@@ -0,0 +1,187 @@
+package gosrv
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "log/slog"
+  "net/http"
+  "strconv"
+  "time"
+)
+
+
+// An HttpLogger writing each request as an slog record with typed
+// attributes, such as Status as an int and RequestTime as a duration.
+// The attributes are the log fields, or the variables of the log format.
+// Encoding is left to the slog.Handler, so SetLogEncoding is ignored.
+type slogHttpLogger struct {
+  *httpLogger
+  logger  *slog.Logger
+}
+
+
+// Creates an HttpLogger writing to the given slog.Logger, or the default
+// slog logger if nil.
+func NewSlogHttpLogger(logger *slog.Logger, formats ...string) HttpLogger {
+  if logger == nil { logger = slog.Default() }
+
+  l := NewHttpLogger(nil, formats...).(*httpLogger)
+  return &slogHttpLogger{httpLogger: l, logger: logger}
+}
+
+
+func (l *slogHttpLogger) SetLogEncoding(encoding string) error {
+  return nil
+}
+
+
+// Writes records as JSON to the given writer, e.g. when logFile is set.
+func (l *slogHttpLogger) SetWriter(wr io.Writer) {
+  l.mutex.Lock()
+  l.logger = slog.New(slog.NewJSONHandler(wr, nil))
+  l.mutex.Unlock()
+}
+
+
+func (l *slogHttpLogger) Write(bytes []byte) (int, error) {
+  l.mutex.RLock()
+  logger := l.logger
+  l.mutex.RUnlock()
+
+  logger.Info(string(bytes))
+  return len(bytes), nil
+}
+
+
+func (l *slogHttpLogger) Printf(format string, i ...interface{}) (int, error) {
+  return l.Write([]byte(fmt.Sprintf(format, i...)))
+}
+
+
+func (l *slogHttpLogger) Println(i ...interface{}) (int, error) {
+  return l.Write([]byte(fmt.Sprint(i...)))
+}
+
+
+// Logs the request at info level, warn for 4xx and error for 5xx statuses.
+func (l *slogHttpLogger) Log(t time.Time, wr http.ResponseWriter, req *http.Request) {
+  l.mutex.RLock()
+  logger := l.logger
+  ctx := &LogContext{TimeFormat: l.timeFormat, redactor: l.redactor}
+  values := l.values
+  fields := l.fields
+  if len(fields) == 0 { fields = l.formatKeys }
+  l.mutex.RUnlock()
+
+  level := slog.LevelInfo
+  if res, ok := wr.(*Response); ok && res.Status >= 500 {
+    level = slog.LevelError
+  } else if ok && res.Status >= 400 {
+    level = slog.LevelWarn
+  }
+
+  if !logger.Enabled(req.Context(), level) { return }
+
+  attrs := make([]slog.Attr, 0, len(fields))
+  for _, k := range fields {
+    v := values[k]
+    attrs = append(attrs, slogAttr(k, v.get(ctx, t, wr, req), t))
+  }
+
+  logger.LogAttrs(req.Context(), level, "request", attrs...)
+}
+
+
+// Returns a typed attribute for the given log keyword and value.
+func slogAttr(key, val string, t time.Time) slog.Attr {
+  name := key[1:]
+
+  switch key {
+  case "$Time", "$TimeUTC", "$TimeISO8601":
+    return slog.Time(name, t)
+  case "$RequestTime", "$RequestTimeMs", "$RequestTimeSec":
+    return slog.Duration(name, time.Since(t))
+  case "$TimeToFirstByte":
+    if us, err := strconv.ParseInt(val, 10, 64); err == nil {
+      return slog.Duration(name, time.Duration(us) * time.Microsecond) }
+  }
+
+  if NumericLogValues[key] {
+    if i, err := strconv.ParseInt(val, 10, 64); err == nil { return slog.Int64(name, i) }
+    if f, err := strconv.ParseFloat(val, 64); err == nil { return slog.Float64(name, f) }
+  }
+
+  return slog.String(name, val)
+}
+
+
+// Maps event levels to slog levels.
+func (lvl LogLevel) slogLevel() slog.Level {
+  switch lvl {
+  case DebugLevel: return slog.LevelDebug
+  case WarnLevel: return slog.LevelWarn
+  case ErrorLevel: return slog.LevelError
+  }
+  return slog.LevelInfo
+}
+
+
+type slogLoggerKey struct{}
+
+
+// Returns a logger for the given request with its request ID, method and
+// path attributes, based on the logger given to Server.SetSlogLogger or
+// the default slog logger.
+func RequestLogger(req *http.Request) *slog.Logger {
+  logger, ok := req.Context().Value(slogLoggerKey{}).(*slog.Logger)
+  if !ok { logger = slog.Default() }
+
+  attrs := []interface{}{}
+  if id := RequestId(req); id != "" { attrs = append(attrs, "requestId", id) }
+  attrs = append(attrs, "method", req.Method, "path", req.URL.Path)
+
+  return logger.With(attrs...)
+}
+
+
+// Returns a context whose requests use the given logger in RequestLogger.
+func withSlogLogger(ctx context.Context, logger *slog.Logger) context.Context {
+  return context.WithValue(ctx, slogLoggerKey{}, logger)
+}
+
+
+// Sends server events, access logs and request loggers through the given
+// slog.Logger. It takes the place of the logger of the top-level log keys,
+// keeping its format, fields, redaction and filter alongside other log
+// sinks, and stays in place on Reload.
+func (s *Server) SetSlogLogger(logger *slog.Logger) {
+  s.Events.SetSlogLogger(logger)
+
+  s.logLock.Lock()
+  defer s.logLock.Unlock()
+
+  l := NewSlogHttpLogger(logger).(*slogHttpLogger)
+  var old *httpLogger
+  switch a := s.accessLogger().(type) {
+  case *httpLogger: old = a
+  case *slogHttpLogger: old = a.httpLogger
+  }
+
+  if old != nil {
+    old.mutex.RLock()
+    format, time_format, fields, redactor := old.logFormat, old.timeFormat, old.fields, old.redactor
+    old.mutex.RUnlock()
+
+    l.SetRedactor(redactor)
+    l.SetLogFormat(format)
+    l.SetTimeFormat(time_format)
+    l.SetLogFields(fields)
+  }
+
+  s.Mux.rwlock.Lock()
+  s.Mux.slog = logger
+  s.Mux.rwlock.Unlock()
+
+  s.setAccessLogger(l)
+}
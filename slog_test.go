@@ -0,0 +1,163 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "encoding/json"
+  "io/ioutil"
+  "log/slog"
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "strings"
+  "time"
+)
+
+
+func testSlogRecord(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+  data := map[string]interface{}{}
+  err := json.Unmarshal(buf.Bytes(), &data)
+  if err != nil { t.Fatal( err ) }
+  buf.Reset()
+  return data
+}
+
+
+func TestSlogHttpLogger(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewSlogHttpLogger(slog.New(slog.NewJSONHandler(buf, nil)),
+    "$RequestMethod $RequestPath $Status $BodyBytes $RequestTime $Time $Header[X-Tenant]")
+
+  req := httptest.NewRequest("GET", "/path", nil)
+  req.Header.Set("X-Tenant", "acme")
+  res := NewResponse(httptest.NewRecorder(), NewMux())
+  res.WriteHeader(503)
+  res.Write([]byte("unavailable"))
+  l.Log(time.Now(), res, req)
+
+  data := testSlogRecord(t, buf)
+  testAssertEqual(t, "ERROR", data["level"])
+  testAssertEqual(t, "request", data["msg"])
+  testAssertEqual(t, "GET", data["RequestMethod"])
+  testAssertEqual(t, "/path", data["RequestPath"])
+  testAssertEqual(t, float64(503), data["Status"])
+  testAssertEqual(t, float64(11), data["BodyBytes"])
+  testAssertEqual(t, "acme", data["Header[X-Tenant]"])
+
+  _, ok := data["RequestTime"].(float64)
+  testAssertEqual(t, true, ok)
+  _, err := time.Parse(time.RFC3339, data["Time"].(string))
+  if err != nil { t.Fatal( err ) }
+
+  res = NewResponse(httptest.NewRecorder(), NewMux())
+  res.WriteHeader(404)
+  l.Log(time.Now(), res, req)
+  testAssertEqual(t, "WARN", testSlogRecord(t, buf)["level"])
+}
+
+
+func TestRequestLogger(t *testing.T) {
+  buf := &bytes.Buffer{}
+  s := New()
+  s.SetSlogLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+  s.Logger.SetWriter(&bytes.Buffer{})
+  s.Mux.TrustRequestIds("192.0.2.0/24")
+
+  s.HandleFunc("/hello", func(wr http.ResponseWriter, req *http.Request) {
+    RequestLogger(req).Info("hello", "name", "world")
+  })
+
+  req := httptest.NewRequest("POST", "/hello", nil)
+  req.Header.Set("X-Request-Id", "abc123")
+  s.Mux.ServeHTTP(httptest.NewRecorder(), req)
+
+  data := testSlogRecord(t, buf)
+  testAssertEqual(t, "hello", data["msg"])
+  testAssertEqual(t, "abc123", data["requestId"])
+  testAssertEqual(t, "POST", data["method"])
+  testAssertEqual(t, "/hello", data["path"])
+  testAssertEqual(t, "world", data["name"])
+}
+
+
+func TestSetSlogLoggerKeepsFormat(t *testing.T) {
+  s := New()
+  s.Logger.SetLogFormat("$Status")
+  s.Logger.SetLogFields([]string{"RequestPath"})
+  s.SetSlogLogger(slog.Default())
+
+  l := s.Logger.(*slogHttpLogger)
+  testAssertEqual(t, "$Status", l.logFormat)
+  testAssertEqual(t, 1, len(l.fields))
+  testAssertEqual(t, "$RequestPath", l.fields[0])
+}
+
+
+func TestSetSlogLoggerSinks(t *testing.T) {
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFile", dir + "/access.log")
+  cfg.Set("logFields", "RequestPath, Status")
+  cfg.Set("logSkip", "/health")
+  cfg.Set("log.errors.file", dir + "/errors.log")
+  cfg.Set("log.errors.format", "$Status")
+  cfg.Set("log.errors.filter", "status>=500")
+
+  s := New()
+  err := s.loadConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  buf := &bytes.Buffer{}
+  s.SetSlogLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+
+  for i := 0; i < 2; i++ {
+    req := httptest.NewRequest("GET", "/health", nil)
+    s.Logger.Log(time.Now(), NewResponse(httptest.NewRecorder(), s.Mux), req)
+    testLogRequest(s.Logger, 500, "")
+
+    data := testSlogRecord(t, buf)
+    testAssertEqual(t, "/path", data["RequestPath"])
+    testAssertEqual(t, float64(500), data["Status"])
+    testAssertEqual(t, nil, data["RequestMethod"])
+
+    // Reloading keeps the slog logger in place of the default sink.
+    err = s.Reload()
+    if err != nil { t.Fatal( err ) }
+  }
+
+  s.logFile.Close()
+  for _, f := range s.sinkFiles { f.Close() }
+
+  errors, _ := ioutil.ReadFile(dir + "/errors.log")
+  testAssertEqual(t, "500\n500\n", string(errors))
+  access, _ := ioutil.ReadFile(dir + "/access.log")
+  testAssertEqual(t, "", string(access))
+}
+
+
+func TestEventLoggerSlog(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewEventLogger(nil)
+  l.SetSlogLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+
+  l.Log(WarnLevel, "Server draining", "addr", ":9000", "active", 3)
+  data := testSlogRecord(t, buf)
+  testAssertEqual(t, "WARN", data["level"])
+  testAssertEqual(t, "Server draining", data["msg"])
+  testAssertEqual(t, float64(3), data["active"])
+
+  l.Debugf("hidden")
+  testAssertEqual(t, "", buf.String())
+}
+
+
+func TestEventLoggerAttrs(t *testing.T) {
+  buf := &bytes.Buffer{}
+  l := NewEventLogger(buf)
+
+  l.Log(InfoLevel, "Server listening", "addr", ":9000", "env", "dev", "error", "a b")
+  testAssertEqual(t, true,
+    strings.HasSuffix(buf.String(), " INFO Server listening addr=:9000 env=dev error=\"a b\"\n"))
+}
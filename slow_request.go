@@ -0,0 +1,82 @@
+package gosrv
+
+import (
+  "bytes"
+  "net/http"
+  "runtime"
+  "strconv"
+  "time"
+)
+
+
+// Largest buffer used to capture goroutine stacks of slow requests.
+const maxSlowStackBuffer = 16 << 20
+
+
+// Logs a "Slow request" warning to the Mux Events logger for requests still
+// running after the threshold, or never if 0. With stacks, the warning
+// includes the stack of the handler goroutine, captured while it's still
+// running. Capturing stacks briefly stops all goroutines, so only enable it
+// with a threshold that few requests exceed.
+func (m *Mux) SetSlowRequestThreshold(threshold time.Duration, stacks bool) {
+  m.rwlock.Lock()
+  m.slowThreshold = threshold
+  m.slowStacks = stacks
+  m.rwlock.Unlock()
+}
+
+
+// Starts a timer logging the request as slow unless stopped before the
+// threshold. Must be called from the handler goroutine.
+func watchSlowRequest(events *EventLogger, start time.Time, req *http.Request,
+  threshold time.Duration, stacks bool) *time.Timer {
+  gid := ""
+  if stacks { gid = goroutineId() }
+  method, path, id := req.Method, req.URL.Path, RequestId(req)
+
+  return time.AfterFunc(threshold - time.Since(start), func() {
+    attrs := []interface{}{"method", method, "path", path, "requestId", id,
+      "elapsed", time.Since(start).Round(time.Millisecond)}
+
+    if gid != "" {
+      if stack := goroutineStack(gid); stack != "" { attrs = append(attrs, "stack", stack) }
+    }
+
+    events.Log(WarnLevel, "Slow request", attrs...)
+  })
+}
+
+
+// Returns the ID of the calling goroutine, from the first line of its
+// stack: "goroutine 123 [running]:".
+func goroutineId() string {
+  var buf [64]byte
+  line := buf[:runtime.Stack(buf[:], false)]
+  line = bytes.TrimPrefix(line, []byte("goroutine "))
+
+  i := bytes.IndexByte(line, ' ')
+  if i < 0 { return "" }
+  if _, err := strconv.ParseUint(string(line[:i]), 10, 64); err != nil { return "" }
+  return string(line[:i])
+}
+
+
+// Returns the stack of the goroutine with the given ID, or "" if it
+// has exited.
+func goroutineStack(gid string) string {
+  buf := make([]byte, 64 << 10)
+  for {
+    n := runtime.Stack(buf, true)
+    if n < len(buf) || len(buf) >= maxSlowStackBuffer {
+      buf = buf[:n]
+      break
+    }
+    buf = make([]byte, len(buf) * 2)
+  }
+
+  header := []byte("goroutine " + gid + " [")
+  for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+    if bytes.HasPrefix(stack, header) { return string(bytes.TrimSpace(stack)) }
+  }
+  return ""
+}
@@ -0,0 +1,104 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "time"
+)
+
+
+//go:noinline
+func testBlockedHandler(release chan bool) {
+  <- release
+}
+
+
+func testSlowMux(events *testSlowWriter) *Mux {
+  m := NewMux()
+  m.Logger = NewHttpLogger(&bytes.Buffer{})
+  m.Events = NewEventLogger(events)
+  return m
+}
+
+
+func TestMuxSlowRequestStack(t *testing.T) {
+  events := &testSlowWriter{release: make(chan bool)}
+  close(events.release)
+
+  release := make(chan bool)
+  m := testSlowMux(events)
+  m.SetSlowRequestThreshold(20 * time.Millisecond, true)
+  m.HandleFunc("/slow", func(wr http.ResponseWriter, req *http.Request) { testBlockedHandler(release) })
+
+  done := make(chan bool)
+  go func() {
+    m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+    close(done)
+  }()
+
+  for i := 0; i < 200 && events.String() == ""; i++ { time.Sleep(10 * time.Millisecond) }
+
+  // The warning is logged while the handler is still blocked.
+  log := events.String()
+  testAssertEqual(t, true, strings.Contains(log, " WARN Slow request method=GET path=/slow requestId="))
+  testAssertEqual(t, true, strings.Contains(log, "testBlockedHandler"))
+  testAssertEqual(t, 1, strings.Count(log, "\n"))
+
+  close(release)
+  <- done
+}
+
+
+func TestMuxSlowRequestThreshold(t *testing.T) {
+  events := &testSlowWriter{release: make(chan bool)}
+  close(events.release)
+
+  m := testSlowMux(events)
+  m.SetSlowRequestThreshold(20 * time.Millisecond, false)
+  m.HandleFunc("/fast", func(wr http.ResponseWriter, req *http.Request) {})
+  m.HandleFunc("/slow", func(wr http.ResponseWriter, req *http.Request) { time.Sleep(50 * time.Millisecond) })
+
+  m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+  time.Sleep(40 * time.Millisecond)
+  testAssertEqual(t, "", events.String())
+
+  m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+  log := events.String()
+  testAssertEqual(t, true, strings.Contains(log, "Slow request method=GET path=/slow"))
+  testAssertEqual(t, false, strings.Contains(log, "stack="))
+
+  m.SetSlowRequestThreshold(0, false)
+  m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+  testAssertEqual(t, log, events.String())
+}
+
+
+func TestGoroutineStack(t *testing.T) {
+  stack := goroutineStack(goroutineId())
+  testAssertEqual(t, true, strings.HasPrefix(stack, "goroutine "))
+  testAssertEqual(t, true, strings.Contains(stack, "TestGoroutineStack"))
+  testAssertEqual(t, "", goroutineStack("0"))
+}
+
+
+func TestMuxSlowRequestPanic(t *testing.T) {
+  events := &testSlowWriter{release: make(chan bool)}
+  close(events.release)
+
+  m := testSlowMux(events)
+  m.SetSlowRequestThreshold(20 * time.Millisecond, true)
+  m.HandleFunc("/panic", func(wr http.ResponseWriter, req *http.Request) { panic("boom") })
+
+  func() {
+    defer func() { recover() }()
+    m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+  }()
+
+  // The timer is stopped and the connection released despite the panic.
+  time.Sleep(40 * time.Millisecond)
+  testAssertEqual(t, "", events.String())
+  m.conns.Wait()
+}
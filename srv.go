@@ -11,7 +11,6 @@ import (
   "io/ioutil"
   "path/filepath"
   "strconv"
-  "strings"
   "syscall"
   "errors"
 )
@@ -26,45 +25,44 @@ var DefaultConfigFile = "server.cfg"
 var DefaultAppDir     = "./"
 var DefaultAppName    = "server"
 
+// Prefix of environment variables overriding config values,
+// e.g. SERVER_ADDR. Derived from DefaultAppName at startup.
+var DefaultEnvPrefix  = "SERVER"
 
-func stopProcessAt(pid_file string, force bool) error {
-  _, err := os.Stat(pid_file)
-  if err != nil {
-    return mkerr("Could not stop server. PID file %s does not exists.", pid_file)}
+// How often to log the number of active requests while the server drains
+// connections on shutdown.
+var DrainLogInterval  = 5 * time.Second
 
-  bytes, err := ioutil.ReadFile(pid_file)
-  if err != nil {
-    return mkerr("Could not stop server. PID file %s is unreadable.", pid_file) }
+// How often to log the number of access log lines dropped, e.g. by
+// logOverflow=drop or a full disk, while the server runs.
+var DroppedLogInterval = time.Minute
 
-  pid, err := strconv.Atoi(string(bytes))
-  if err != nil {
-    return mkerr("Could not stop server. PID file %s is invalid.", pid_file) }
 
-  proc, err := os.FindProcess(pid)
-  if err != nil {
-    return mkerr("Could not stop server. PID %d is invalid.", pid) }
+func stopProcessAt(pid_file string, force bool, timeout time.Duration) error {
+  proc, err := findProcessAt(pid_file)
+  if err != nil { return mkerr("Could not stop server. %v", err) }
 
   err = proc.Signal(os.Interrupt)
   if err != nil {
-    return mkerr("Could not stop server. PID %d was unresponsive.", pid) }
+    return mkerr("Could not stop server. PID %d was unresponsive.", proc.Pid) }
 
   if force {
     return proc.Signal(os.Kill) }
 
-  for !waitForProc(proc) {
+  for !waitForProc(proc, timeout) {
     text := ""
 
     if fileIsTTY(os.Stdin) {
       reader := bufio.NewReader(os.Stdin)
-      fmt.Printf("Process %d is taking too long to stop.\nForce exit? (y/N) ", pid)
+      fmt.Printf("Process %d is taking too long to stop.\nForce exit? (y/N) ", proc.Pid)
       text, _ = reader.ReadString('\n')
     } else {
-      return mkerr("Process %d is taking too long to exit.", pid)
+      return mkerr("Process %d is taking too long to exit.", proc.Pid)
     }
 
     if (text == "y\n" || text == "Y\n") {
       err = proc.Signal(os.Kill)
-      if err == nil && !waitForProc(proc) {
+      if err == nil && !waitForProc(proc, timeout) {
         return mkerr("Process could not be stopped.")
       }
     }
@@ -74,6 +72,41 @@ func stopProcessAt(pid_file string, force bool) error {
 }
 
 
+// Sends a signal to the process at the given pid file.
+func signalProcessAt(pid_file string, sig os.Signal) error {
+  proc, err := findProcessAt(pid_file)
+  if err != nil { return mkerr("Could not signal server. %v", err) }
+
+  err = proc.Signal(sig)
+  if err != nil { return mkerr("PID %d was unresponsive.", proc.Pid) }
+
+  return nil
+}
+
+
+// Returns the running process of the given pid file.
+func findProcessAt(pid_file string) (*os.Process, error) {
+  _, err := os.Stat(pid_file)
+  if err != nil {
+    return nil, fmt.Errorf("PID file %s does not exists.", pid_file)}
+
+  bytes, err := ioutil.ReadFile(pid_file)
+  if err != nil {
+    return nil, fmt.Errorf("PID file %s is unreadable.", pid_file) }
+
+  pid, err := strconv.Atoi(string(bytes))
+  if err != nil {
+    return nil, fmt.Errorf("PID file %s is invalid.", pid_file) }
+
+  proc, err := os.FindProcess(pid)
+  if err == nil { err = proc.Signal(syscall.Signal(0)) }
+  if err != nil {
+    return nil, fmt.Errorf("PID %d is not running.", pid) }
+
+  return proc, nil
+}
+
+
 func fileIsTTY(file *os.File) bool {
   info, err := file.Stat()
   if err != nil { return false }
@@ -82,10 +115,10 @@ func fileIsTTY(file *os.File) bool {
 }
 
 
-func waitForProc(proc *os.Process) bool {
+func waitForProc(proc *os.Process, timeout time.Duration) bool {
   var err error
-  // Check every 100 ms up to 100 times (10s total)
-  for i := 0; err == nil && i < 100; i++ {
+  // Check every 100 ms until the timeout
+  for i := time.Duration(0); err == nil && i < timeout; i += 100 * time.Millisecond {
     time.Sleep(100 * time.Millisecond)
     err = proc.Signal(syscall.Signal(0))
   }
@@ -105,19 +138,10 @@ func exit(status int, msg string, obj ...interface{}) {
 }
 
 
+// Starts a new process with the given args from the app directory.
 func daemonize(args []string) {
-  procArgs := []string{}
-  opt := ""
-
-  for _, arg := range args {
-    if strings.HasPrefix(arg, "-") { opt = arg }
-    if opt != "-d" && opt != "-stop" && opt != "-restart" {
-      procArgs = append(procArgs, arg)
-    }
-  }
-
-  procName := filepath.Base(procArgs[0])
-  procArgs[0] = procName
+  procName := filepath.Base(args[0])
+  procArgs := append([]string{procName}, args[1:]...)
   procAttr := &os.ProcAttr{
     Dir: DefaultAppDir,
     Env: os.Environ(),
@@ -138,6 +162,7 @@ func setDefaults(args []string) {
 
   DefaultAppDir     = filepath.Dir(path)
   DefaultAppName    = filepath.Base(args[0])
+  DefaultEnvPrefix  = envVarFormat(DefaultAppName)
 
   DefaultPidFile    = filepath.Join(DefaultAppDir, DefaultAppName + ".pid")
   DefaultConfigFile = filepath.Join(DefaultAppDir, DefaultAppName + ".cfg")
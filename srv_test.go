@@ -47,6 +47,7 @@ func TestDefaultVars(t *testing.T) {
   testAssertEqual(t, path+".pid", DefaultPidFile)
   testAssertEqual(t, path+".cfg", DefaultConfigFile)
   testAssertEqual(t, "gosrv.test", DefaultAppName)
+  testAssertEqual(t, "GOSRV_TEST", DefaultEnvPrefix)
   testAssertEqual(t, "dev", DefaultEnv)
   testAssertEqual(t, false, ForceProdEnv)
 }
@@ -59,7 +60,7 @@ func TestStopProcessAt(t *testing.T) {
   pwd, _ := os.Getwd()
 
   pidfile := filepath.Join(pwd, testDaemon+".pid")
-  err := stopProcessAt(pidfile)
+  err := stopProcessAt(pidfile, false, 10 * time.Second)
   if err != nil { t.Fatal( err ) }
 
   _, err = os.Stat(pidfile)
@@ -0,0 +1,278 @@
+package gosrv
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "net"
+  "net/url"
+  "os"
+  "strconv"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+
+// Number of messages a SyslogWriter buffers before dropping them.
+var DefaultSyslogBufferSize = 1024
+
+// Time a SyslogWriter waits to connect to the daemon before dropping
+// the message.
+var DefaultSyslogDialTimeout = 5 * time.Second
+
+// Local syslog daemon sockets tried by syslog:// targets.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+// RFC 5424 timestamp format, limited to microseconds.
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+
+var syslogFacilities = map[string]int {
+  "kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+  "lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+  "local0": 16, "local1": 17, "local2": 18, "local3": 19,
+  "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[string]int {
+  "emerg": 0, "alert": 1, "crit": 2, "err": 3, "error": 3,
+  "warning": 4, "warn": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+
+// A log writer sending each line to a syslog daemon, framed per RFC 5424,
+// or to journald. Writes never block: lines are queued and sent in the
+// background, and dropped when the queue is full or the daemon is
+// unreachable. Safe for concurrent use.
+type SyslogWriter struct {
+  Facility  int
+  Severity  int
+  Tag       string
+  Hostname  string
+
+  network   string
+  addr      string
+  journald  bool
+  conn      net.Conn
+  queue     chan []byte
+  done      chan bool
+  dropped   int64
+  closed    bool
+  mutex     sync.RWMutex
+  connMutex sync.Mutex
+}
+
+
+// Returns true if the given logFile value is a syslog or journald target
+// rather than a file path.
+func IsSyslogTarget(target string) bool {
+  return target == "journald" || strings.HasPrefix(target, "journald:") ||
+    strings.HasPrefix(target, "syslog:") || strings.HasPrefix(target, "syslog+")
+}
+
+
+// Connects to a syslog or journald target:
+//  * syslog://                 the local syslog daemon
+//  * syslog:///path/to/socket  a local syslog unix socket
+//  * syslog+udp://host:514     a remote syslog daemon over UDP
+//  * syslog+tcp://host:514     a remote syslog daemon over TCP
+//  * journald                  the local systemd journal
+//  * journald:///path/to/socket
+// Messages use the user facility, info severity and DefaultAppName tag
+// until set otherwise. The connection is made in the background when the
+// first message is sent, so an unreachable daemon only drops messages.
+func DialSyslog(target string) (*SyslogWriter, error) {
+  w := &SyslogWriter{Facility: syslogFacilities["user"], Severity: syslogSeverities["info"],
+    Tag: DefaultAppName, queue: make(chan []byte, DefaultSyslogBufferSize),
+    done: make(chan bool)}
+  w.Hostname, _ = os.Hostname()
+
+  if target == "journald" { target = "journald://" + journaldSocket }
+
+  u, err := url.Parse(target)
+  if err != nil { return nil, mkerr("Invalid syslog target %q.", target) }
+
+  switch u.Scheme {
+  case "journald":
+    w.network, w.addr, w.journald = "unixgram", u.Path, true
+  case "syslog":
+    w.network, w.addr = "unixgram", u.Path
+  case "syslog+udp", "syslog+tcp":
+    w.network, w.addr = strings.TrimPrefix(u.Scheme, "syslog+"), u.Host
+    if u.Port() == "" { w.addr = net.JoinHostPort(u.Hostname(), "514") }
+  default:
+    return nil, mkerr("Invalid syslog target %q.", target)
+  }
+
+  go w.run()
+  return w, nil
+}
+
+
+// Queues each line of the given bytes as a message.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+  w.mutex.RLock()
+  defer w.mutex.RUnlock()
+  if w.closed { return 0, os.ErrClosed }
+
+  for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+    if len(line) == 0 { continue }
+
+    select {
+    case w.queue <- w.format(line, time.Now()):
+    default:
+      atomic.AddInt64(&w.dropped, 1)
+    }
+  }
+
+  return len(p), nil
+}
+
+
+// Returns the number of messages dropped because the queue was full or
+// the daemon was unreachable.
+func (w *SyslogWriter) Dropped() int64 {
+  return atomic.LoadInt64(&w.dropped)
+}
+
+
+// Reconnects to the daemon when sending the next message, e.g. after it
+// was restarted.
+func (w *SyslogWriter) Reopen() error {
+  w.connMutex.Lock()
+  defer w.connMutex.Unlock()
+
+  if w.conn == nil { return nil }
+  err := w.conn.Close()
+  w.conn = nil
+  return err
+}
+
+
+// Sends the queued messages and closes the connection.
+func (w *SyslogWriter) Close() error {
+  w.mutex.Lock()
+  if w.closed {
+    w.mutex.Unlock()
+    return nil
+  }
+  w.closed = true
+  close(w.queue)
+  w.mutex.Unlock()
+
+  <- w.done
+
+  w.connMutex.Lock()
+  defer w.connMutex.Unlock()
+  if w.conn == nil { return nil }
+  return w.conn.Close()
+}
+
+
+func (w *SyslogWriter) run() {
+  for msg := range w.queue { w.send(msg) }
+  close(w.done)
+}
+
+
+func (w *SyslogWriter) connect() error {
+  w.connMutex.Lock()
+  defer w.connMutex.Unlock()
+
+  if w.conn != nil { return nil }
+
+  addrs := []string{w.addr}
+  if w.addr == "" && !w.journald { addrs = syslogSockets }
+
+  var err error
+  for _, addr := range addrs {
+    w.conn, err = net.DialTimeout(w.network, addr, DefaultSyslogDialTimeout)
+    if err == nil { return nil }
+  }
+  return fmt.Errorf("could not connect to syslog: %v", err)
+}
+
+
+func (w *SyslogWriter) send(msg []byte) {
+  err := w.connect()
+  if err != nil {
+    atomic.AddInt64(&w.dropped, 1)
+    return
+  }
+
+  w.connMutex.Lock()
+  defer w.connMutex.Unlock()
+  if w.conn == nil {
+    atomic.AddInt64(&w.dropped, 1)
+    return
+  }
+
+  _, err = w.conn.Write(msg)
+  if err != nil {
+    atomic.AddInt64(&w.dropped, 1)
+    w.conn.Close()
+    w.conn = nil
+  }
+}
+
+
+// Frames a message for the daemon.
+func (w *SyslogWriter) format(line []byte, t time.Time) []byte {
+  if w.journald { return w.formatJournald(line) }
+
+  host := w.Hostname
+  if host == "" { host = "-" }
+
+  msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", w.Facility * 8 + w.Severity,
+    t.Format(syslogTimeFormat), host, syslogTag(w.Tag), os.Getpid(), line)
+
+  if w.network == "tcp" { msg = strconv.Itoa(len(msg)) + " " + msg }
+  return []byte(msg)
+}
+
+
+// Formats a message with the journald native protocol.
+func (w *SyslogWriter) formatJournald(line []byte) []byte {
+  buf := &bytes.Buffer{}
+  fmt.Fprintf(buf, "PRIORITY=%d\nSYSLOG_FACILITY=%d\nSYSLOG_IDENTIFIER=%s\n",
+    w.Severity, w.Facility, syslogTag(w.Tag))
+
+  buf.WriteString("MESSAGE\n")
+  binary.Write(buf, binary.LittleEndian, uint64(len(line)))
+  buf.Write(line)
+  buf.WriteByte('\n')
+  return buf.Bytes()
+}
+
+
+// Returns the tag as an RFC 5424 APP-NAME: up to 48 printable characters.
+func syslogTag(tag string) string {
+  tag = strings.Map(func(r rune) rune {
+    if r <= ' ' || r > '~' { return '_' }
+    return r
+  }, tag)
+
+  if tag == "" { return "-" }
+  if len(tag) > 48 { tag = tag[:48] }
+  return tag
+}
+
+
+// Returns the syslog facility code for a name such as local0.
+func ParseSyslogFacility(name string) (int, error) {
+  f, ok := syslogFacilities[strings.ToLower(strings.TrimSpace(name))]
+  if !ok { return 0, fmt.Errorf("%q is not a syslog facility", name) }
+  return f, nil
+}
+
+
+// Returns the syslog severity code for a name such as info.
+func ParseSyslogSeverity(name string) (int, error) {
+  s, ok := syslogSeverities[strings.ToLower(strings.TrimSpace(name))]
+  if !ok { return 0, fmt.Errorf("%q is not a syslog severity", name) }
+  return s, nil
+}
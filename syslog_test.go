@@ -0,0 +1,194 @@
+package gosrv
+
+import (
+  "testing"
+  "bytes"
+  "encoding/binary"
+  "io/ioutil"
+  "net"
+  "os"
+  "path/filepath"
+  "regexp"
+  "time"
+)
+
+
+func testSyslogRead(t *testing.T, conn net.PacketConn) string {
+  buf := make([]byte, 4096)
+  conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+  n, _, err := conn.ReadFrom(buf)
+  if err != nil { t.Fatal( err ) }
+  return string(buf[:n])
+}
+
+
+func TestSyslogWriterUDP(t *testing.T) {
+  conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+  if err != nil { t.Fatal( err ) }
+  defer conn.Close()
+
+  w, err := DialSyslog("syslog+udp://" + conn.LocalAddr().String())
+  if err != nil { t.Fatal( err ) }
+  defer w.Close()
+
+  w.Facility = syslogFacilities["local3"]
+  w.Severity = syslogSeverities["notice"]
+  w.Tag = "my app"
+  w.Hostname = "web1"
+
+  w.Write([]byte("GET / 200\nGET /a 404\n"))
+
+  pattern := regexp.MustCompile(`^<157>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ web1 my_app \d+ - - GET / 200$`)
+  msg := testSyslogRead(t, conn)
+  if !pattern.MatchString(msg) { t.Fatalf("Unexpected syslog message %q", msg) }
+
+  msg = testSyslogRead(t, conn)
+  testAssertEqual(t, true, bytes.HasSuffix([]byte(msg), []byte(" - - GET /a 404")))
+  testAssertEqual(t, int64(0), w.Dropped())
+}
+
+
+func TestSyslogWriterUnixgram(t *testing.T) {
+  dir, err := ioutil.TempDir("", "gosrv-syslog")
+  if err != nil { t.Fatal( err ) }
+  defer os.RemoveAll(dir)
+
+  path := filepath.Join(dir, "log.sock")
+  conn, err := net.ListenPacket("unixgram", path)
+  if err != nil { t.Fatal( err ) }
+  defer conn.Close()
+
+  w, err := DialSyslog("syslog://" + path)
+  if err != nil { t.Fatal( err ) }
+
+  w.Write([]byte("hello\n"))
+  w.Close()
+
+  msg := testSyslogRead(t, conn)
+  testAssertEqual(t, true, bytes.HasPrefix([]byte(msg), []byte("<14>1 ")))
+  testAssertEqual(t, true, bytes.HasSuffix([]byte(msg), []byte(" - - hello")))
+
+  _, err = w.Write([]byte("closed\n"))
+  if err == nil { t.Fatal( "Expected write error after close" ) }
+}
+
+
+func TestSyslogWriterJournald(t *testing.T) {
+  dir, err := ioutil.TempDir("", "gosrv-syslog")
+  if err != nil { t.Fatal( err ) }
+  defer os.RemoveAll(dir)
+
+  path := filepath.Join(dir, "journal.sock")
+  conn, err := net.ListenPacket("unixgram", path)
+  if err != nil { t.Fatal( err ) }
+  defer conn.Close()
+
+  w, err := DialSyslog("journald://" + path)
+  if err != nil { t.Fatal( err ) }
+  defer w.Close()
+  w.Tag = "myapp"
+  w.Severity = syslogSeverities["err"]
+
+  w.Write([]byte("failed\n"))
+
+  msg := []byte(testSyslogRead(t, conn))
+  header := "PRIORITY=3\nSYSLOG_FACILITY=1\nSYSLOG_IDENTIFIER=myapp\nMESSAGE\n"
+  testAssertEqual(t, header, string(msg[:len(header)]))
+
+  size := binary.LittleEndian.Uint64(msg[len(header):])
+  testAssertEqual(t, uint64(6), size)
+  testAssertEqual(t, "failed\n", string(msg[len(header)+8:]))
+}
+
+
+func TestSyslogWriterDrops(t *testing.T) {
+  conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+  if err != nil { t.Fatal( err ) }
+  defer conn.Close()
+
+  size := DefaultSyslogBufferSize
+  DefaultSyslogBufferSize = 1
+  defer func() { DefaultSyslogBufferSize = size }()
+
+  w, err := DialSyslog("syslog+udp://" + conn.LocalAddr().String())
+  if err != nil { t.Fatal( err ) }
+
+  // Hold the connection so the queue fills up.
+  w.connMutex.Lock()
+  for i := 0; i < 5; i++ { w.Write([]byte("line\n")) }
+  w.connMutex.Unlock()
+  w.Close()
+
+  if w.Dropped() < 3 { t.Fatalf("Expected at least 3 dropped messages, got %d", w.Dropped()) }
+}
+
+
+func TestLoadLogConfigSyslogUnreachable(t *testing.T) {
+  ln, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil { t.Fatal( err ) }
+  addr := ln.Addr().String()
+  ln.Close()
+
+  dir := testRotateDir(t)
+  defer os.RemoveAll(dir)
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFile", "syslog+tcp://" + addr)
+
+  s := New()
+  events := &bytes.Buffer{}
+  s.Events.SetWriter(events)
+
+  err = s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+
+  w := s.logFile.(*SyslogWriter)
+  w.Write([]byte("line\n"))
+
+  cfg.Set("logFile", filepath.Join(dir, "access.log"))
+  err = s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  defer s.logFile.Close()
+
+  testAssertEqual(t, int64(1), w.Dropped())
+  if !bytes.Contains(events.Bytes(), []byte("Access log lines dropped")) {
+    t.Fatalf("Expected dropped lines event, got %q", events.String()) }
+}
+
+
+func TestSyslogTarget(t *testing.T) {
+  testAssertEqual(t, true, IsSyslogTarget("syslog://"))
+  testAssertEqual(t, true, IsSyslogTarget("syslog+udp://host:514"))
+  testAssertEqual(t, true, IsSyslogTarget("journald"))
+  testAssertEqual(t, false, IsSyslogTarget("logs/syslog.log"))
+
+  _, err := DialSyslog("syslog+http://host")
+  if err == nil { t.Fatal( "Expected invalid target error" ) }
+}
+
+
+func TestLoadLogConfigSyslog(t *testing.T) {
+  conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+  if err != nil { t.Fatal( err ) }
+  defer conn.Close()
+
+  cfg := NewConfig("dev")
+  cfg.Set("logFile", "syslog+udp://" + conn.LocalAddr().String())
+  cfg.Set("syslogFacility", "local0")
+  cfg.Set("syslogSeverity", "warning")
+  cfg.Set("syslogTag", "access")
+
+  s := New()
+  err = s.loadLogConfig(cfg)
+  if err != nil { t.Fatal( err ) }
+  defer s.logFile.Close()
+
+  w := s.logFile.(*SyslogWriter)
+  testAssertEqual(t, 16, w.Facility)
+  testAssertEqual(t, 4, w.Severity)
+  testAssertEqual(t, "access", w.Tag)
+
+  cfg.Set("syslogFacility", "nope")
+  err = s.loadLogConfig(cfg)
+  if err == nil { t.Fatal( "Expected invalid facility error" ) }
+}
@@ -0,0 +1,110 @@
+package gosrv
+
+import (
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "runtime"
+  "runtime/debug"
+  "strings"
+)
+
+
+// The gosrv version, set at build time with
+// -ldflags "-X github.com/jcasts/gosrv.Version=0.2.0". When left at "dev",
+// ReadBuildInfo reports the gosrv module version the binary was built with.
+var Version = "dev"
+
+const gosrvModulePath = "github.com/jcasts/gosrv"
+
+// App version reported by -version, overriding the main module version
+// when set, e.g. with -ldflags "-X github.com/jcasts/gosrv.AppVersion=1.2.3".
+var AppVersion = ""
+
+// App-supplied build fields reported by -version and VersionHandler.
+var VersionFields = map[string]string{}
+
+
+// Build metadata of the running binary.
+type BuildInfo struct {
+  Version      string            `json:"version"`
+  Revision     string            `json:"revision,omitempty"`
+  RevisionTime string            `json:"revisionTime,omitempty"`
+  Modified     bool              `json:"modified,omitempty"`
+  GoVersion    string            `json:"goVersion"`
+  GosrvVersion string            `json:"gosrvVersion"`
+  Fields       map[string]string `json:"fields,omitempty"`
+}
+
+
+// Returns the build metadata of the running binary, read from the main
+// module and VCS info embedded by the go tool.
+func ReadBuildInfo() BuildInfo {
+  info := BuildInfo{Version: AppVersion, GoVersion: runtime.Version(),
+    GosrvVersion: Version, Fields: VersionFields}
+
+  bi, ok := debug.ReadBuildInfo()
+  if ok {
+    if info.Version == "" { info.Version = bi.Main.Version }
+    if info.GosrvVersion == "dev" { info.GosrvVersion = gosrvModuleVersion(bi) }
+
+    for _, s := range bi.Settings {
+      switch s.Key {
+      case "vcs.revision": info.Revision = s.Value
+      case "vcs.time": info.RevisionTime = s.Value
+      case "vcs.modified": info.Modified = s.Value == "true"
+      }
+    }
+  }
+
+  if info.Version == "" { info.Version = "(devel)" }
+  return info
+}
+
+
+// Returns the version of the gosrv module in the given build info, or
+// "dev" if it is built from a local checkout.
+func gosrvModuleVersion(bi *debug.BuildInfo) string {
+  mods := append([]*debug.Module{&bi.Main}, bi.Deps...)
+  for _, mod := range mods {
+    if mod.Path != gosrvModulePath { continue }
+    if mod.Replace != nil { mod = mod.Replace }
+    if mod.Version != "" && mod.Version != "(devel)" { return mod.Version }
+  }
+  return "dev"
+}
+
+
+func (b BuildInfo) String() string {
+  parts := []string{}
+  if b.Revision != "" {
+    rev := b.Revision
+    if len(rev) > 12 { rev = rev[:12] }
+    if b.Modified { rev += "-dirty" }
+    parts = append(parts, "rev " + rev)
+  }
+  if b.RevisionTime != "" { parts = append(parts, b.RevisionTime) }
+  parts = append(parts, b.GoVersion, "gosrv " + b.GosrvVersion)
+
+  for _, k := range sortedFieldKeys(b.Fields) {
+    parts = append(parts, k + "=" + b.Fields[k]) }
+
+  return fmt.Sprintf("%s %s (%s)", DefaultAppName, b.Version, strings.Join(parts, ", "))
+}
+
+
+func sortedFieldKeys(fields map[string]string) []string {
+  m := map[string]interface{}{}
+  for k, _ := range fields { m[k] = nil }
+  return sortedKeys(m)
+}
+
+
+// Returns a handler responding with the build metadata as JSON,
+// e.g. s.Handle("/version", gosrv.VersionHandler()).
+func VersionHandler() http.Handler {
+  return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+    wr.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(wr).Encode(ReadBuildInfo())
+  })
+}
@@ -0,0 +1,62 @@
+package gosrv
+
+import (
+  "testing"
+  "encoding/json"
+  "net/http/httptest"
+  "runtime"
+  "runtime/debug"
+  "strings"
+)
+
+
+func TestReadBuildInfo(t *testing.T) {
+  oldVersion := AppVersion
+  defer func(){ AppVersion = oldVersion }()
+  AppVersion = "1.2.3"
+
+  VersionFields["build"] = "42"
+  defer delete(VersionFields, "build")
+
+  info := ReadBuildInfo()
+  testAssertEqual(t, "1.2.3", info.Version)
+  testAssertEqual(t, runtime.Version(), info.GoVersion)
+  testAssertEqual(t, Version, info.GosrvVersion)
+  testAssertEqual(t, "42", info.Fields["build"])
+
+  str := info.String()
+  testAssertEqual(t, true, strings.HasPrefix(str, "gosrv.test 1.2.3 ("))
+  testAssertEqual(t, true, strings.HasSuffix(str, "gosrv "+Version+", build=42)"))
+}
+
+
+func TestGosrvModuleVersion(t *testing.T) {
+  bi := &debug.BuildInfo{Main: debug.Module{Path: "example.com/app", Version: "v1.0.0"},
+    Deps: []*debug.Module{{Path: gosrvModulePath, Version: "v0.3.1"}}}
+  testAssertEqual(t, "v0.3.1", gosrvModuleVersion(bi))
+
+  bi.Deps[0].Replace = &debug.Module{Path: "../gosrv"}
+  testAssertEqual(t, "dev", gosrvModuleVersion(bi))
+
+  bi = &debug.BuildInfo{Main: debug.Module{Path: gosrvModulePath, Version: "(devel)"}}
+  testAssertEqual(t, "dev", gosrvModuleVersion(bi))
+
+  oldVersion := Version
+  defer func(){ Version = oldVersion }()
+  Version = "0.2.0"
+  testAssertEqual(t, "0.2.0", ReadBuildInfo().GosrvVersion)
+}
+
+
+func TestVersionHandler(t *testing.T) {
+  rec := httptest.NewRecorder()
+  VersionHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/version", nil))
+
+  testAssertEqual(t, "application/json", rec.Header().Get("Content-Type"))
+
+  info := BuildInfo{}
+  err := json.Unmarshal(rec.Body.Bytes(), &info)
+  if err != nil { t.Fatal( err ) }
+  testAssertEqual(t, Version, info.GosrvVersion)
+  testAssertEqual(t, runtime.Version(), info.GoVersion)
+}